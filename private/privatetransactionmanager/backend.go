@@ -0,0 +1,66 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"errors"
+)
+
+// Backend identifies the privacy manager implementation behind a Client.
+type Backend int
+
+const (
+	BackendUnknown Backend = iota
+	BackendConstellation
+	BackendTessera
+)
+
+func (b Backend) String() string {
+	switch b {
+	case BackendConstellation:
+		return "constellation"
+	case BackendTessera:
+		return "tessera"
+	default:
+		return "unknown"
+	}
+}
+
+// BackendInfo describes the privacy manager implementation behind a Client.
+type BackendInfo struct {
+	Backend Backend
+	Version string // as reported by the privacy manager, empty if unknown
+}
+
+// DetectBackend finds out whether the client talks to Constellation or
+// Tessera, and which version, so that callers can pick the APIs only one of
+// them supports. Constellation has no version endpoint, so a privacy manager
+// reporting its version is Tessera. Otherwise Tessera is still recognised by
+// its JSON party info, which is only served on its P2P interface; a privacy
+// manager that refuses both is taken to be Constellation. The result is
+// cached, later calls don't query the privacy manager again.
+func (c *Client) DetectBackend(ctx context.Context) (*BackendInfo, error) {
+	c.backendMu.Lock()
+	defer c.backendMu.Unlock()
+
+	if c.backend != nil {
+		info := *c.backend
+		return &info, nil
+	}
+	version, err := c.GetVersion(ctx)
+	var statusErr *StatusError
+	if err != nil && !errors.As(err, &statusErr) {
+		return nil, err
+	}
+	info := &BackendInfo{Backend: BackendTessera, Version: version}
+	if err != nil {
+		if _, err := c.GetPartyInfo(ctx); err != nil {
+			if !errors.As(err, &statusErr) {
+				return nil, err
+			}
+			info.Backend = BackendConstellation
+		}
+	}
+	c.backend = info
+	cached := *info
+	return &cached, nil
+}
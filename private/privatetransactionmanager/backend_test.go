@@ -0,0 +1,64 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDetectBackend(t *testing.T) {
+	tests := []struct {
+		version, partyInfo bool
+		want               BackendInfo
+		calls              int32
+	}{
+		// Tessera answers the version on its Q2T socket, party info or not.
+		{true, true, BackendInfo{Backend: BackendTessera, Version: "0.10.2"}, 1},
+		{true, false, BackendInfo{Backend: BackendTessera, Version: "0.10.2"}, 1},
+		{false, true, BackendInfo{Backend: BackendTessera}, 2},
+		{false, false, BackendInfo{Backend: BackendConstellation}, 2},
+	}
+	for _, test := range tests {
+		var calls int32
+		socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			switch {
+			case r.URL.Path == "/version" && test.version:
+				w.Write([]byte("0.10.2\n"))
+			case r.URL.Path == "/partyinfo" && test.partyInfo:
+				w.Write([]byte(`{"url": "http://127.0.0.1:9001/", "peers": [], "keys": []}`))
+			default:
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			}
+		}))
+
+		c, err := NewClient(socketPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			info, err := c.DetectBackend(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *info != test.want {
+				t.Errorf("got %+v, want %+v", info, test.want)
+			}
+		}
+		if calls != test.calls {
+			t.Errorf("%+v: got %d requests, want %d with the result cached", test.want, calls, test.calls)
+		}
+		shutdown()
+	}
+}
+
+func TestDetectBackendUnreachable(t *testing.T) {
+	c, err := NewClient("/nonexistent/tm.ipc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.DetectBackend(context.Background()); err == nil {
+		t.Fatal("expected error for unreachable node")
+	}
+}
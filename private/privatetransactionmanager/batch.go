@@ -0,0 +1,122 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// defaultBatchConcurrency is the number of requests a batch call keeps in
+// flight unless configured otherwise with WithBatchConcurrency.
+const defaultBatchConcurrency = 4
+
+// SendItem is a payload to be sent by SendPayloadBatch.
+type SendItem struct {
+	Payload []byte
+	From    string   // base64 encoded sender key, or empty for the default
+	To      []string // base64 encoded recipient keys
+}
+
+// SendResult is the outcome of sending a payload in a batch or asynchronously.
+type SendResult struct {
+	Hash common.EncryptedPayloadHash
+	Err  error
+
+	// ManagedParties are the keys of the parties managed by the privacy
+	// manager that the payload was sent to, if it reports them.
+	ManagedParties []PublicKey
+}
+
+// SendPayloadBatch sends all items, keeping up to the configured batch
+// concurrency of requests in flight. A failed send doesn't affect the others;
+// its error is reported in the result at the same index as the item. The
+// returned error is only non-nil if ctx was done before all items were sent.
+func (c *Client) SendPayloadBatch(ctx context.Context, items []SendItem) ([]SendResult, error) {
+	results := make([]SendResult, len(items))
+	err := c.runBatch(ctx, len(items), func(i int) {
+		item := items[i]
+		results[i] = c.sendPayload(ctx, item.Payload, item.From, item.To, &SendOptions{})
+	}, func(i int, err error) {
+		results[i].Err = err
+	})
+	return results, err
+}
+
+// SendPayloadAsync sends pl like SendPayloadResult on a separate goroutine, so
+// that many sends can be pipelined without waiting for each. The result is
+// delivered on the returned channel, which is closed afterwards; it is
+// buffered, so the send completes even if the result is never received.
+func (c *Client) SendPayloadAsync(ctx context.Context, pl []byte, b64From string, b64To []string) <-chan SendResult {
+	result := make(chan SendResult, 1)
+	go func() {
+		defer close(result)
+		result <- c.sendPayload(ctx, pl, b64From, b64To, &SendOptions{})
+	}()
+	return result
+}
+
+// ReceiveResult is the outcome of retrieving a single payload.
+type ReceiveResult struct {
+	Payload []byte
+	Err     error
+}
+
+// ReceivePayloadBatch retrieves the payloads stored under keys like
+// SendPayloadBatch sends them, returning the results in the order of keys.
+func (c *Client) ReceivePayloadBatch(ctx context.Context, keys [][]byte) ([]ReceiveResult, error) {
+	results := make([]ReceiveResult, len(keys))
+	err := c.runBatch(ctx, len(keys), func(i int) {
+		results[i].Payload, results[i].Err = c.ReceivePayload(ctx, keys[i])
+	}, func(i int, err error) {
+		results[i].Err = err
+	})
+	return results, err
+}
+
+// IsSenderResult is the outcome of an IsSender query for a single payload.
+type IsSenderResult struct {
+	IsSender bool
+	Err      error
+}
+
+// IsSenderBatch asks whether the local node sent each of the payloads txHashes
+// like SendPayloadBatch sends payloads, returning the results in the order of
+// txHashes.
+func (c *Client) IsSenderBatch(ctx context.Context, txHashes []common.EncryptedPayloadHash) ([]IsSenderResult, error) {
+	results := make([]IsSenderResult, len(txHashes))
+	err := c.runBatch(ctx, len(txHashes), func(i int) {
+		results[i].IsSender, results[i].Err = c.IsSender(ctx, txHashes[i])
+	}, func(i int, err error) {
+		results[i].Err = err
+	})
+	return results, err
+}
+
+// runBatch calls do for the indices 0 to n-1 with bounded concurrency and
+// waits for all calls to return. Indices not yet started when ctx is done are
+// passed to skip with the context error instead.
+func (c *Client) runBatch(ctx context.Context, n int, do func(i int), skip func(i int, err error)) error {
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, c.cfg.batchConcurrency)
+	)
+	for i := 0; i < n; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			for ; i < n; i++ {
+				skip(i, ctx.Err())
+			}
+			wg.Wait()
+			return ctx.Err()
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() { <-sem; wg.Done() }()
+			do(i)
+		}(i)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
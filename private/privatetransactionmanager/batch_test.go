@@ -0,0 +1,195 @@
+package privatetransactionmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestSendPayloadBatch(t *testing.T) {
+	var inFlight, maxInFlight int32
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		pl, _ := ioutil.ReadAll(r.Body)
+		if bytes.Equal(pl, []byte("fail")) {
+			http.Error(w, "failure", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(common.BytesToEncryptedPayloadHash(pl).ToBase64()))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath, WithBatchConcurrency(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := make([]SendItem, 8)
+	for i := range items {
+		items[i] = SendItem{Payload: []byte{byte(i)}, To: []string{testRecipient}}
+	}
+	items[3].Payload = []byte("fail")
+
+	results, err := c.SendPayloadBatch(context.Background(), items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, res := range results {
+		if i == 3 {
+			if res.Err == nil {
+				t.Errorf("item %d: expected error", i)
+			}
+			continue
+		}
+		if res.Err != nil {
+			t.Errorf("item %d: %v", i, res.Err)
+		} else if want := common.BytesToEncryptedPayloadHash(items[i].Payload); res.Hash != want {
+			t.Errorf("item %d: got hash %x, want %x", i, res.Hash, want)
+		}
+	}
+	if max := atomic.LoadInt32(&maxInFlight); max > 2 {
+		t.Fatalf("%d requests were in flight, want at most 2", max)
+	}
+}
+
+func TestSendPayloadBatchCancel(t *testing.T) {
+	c, err := NewClient("/nonexistent/tm.ipc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := c.SendPayloadBatch(ctx, make([]SendItem, 3))
+	if err != context.Canceled {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+	for i, res := range results {
+		if res.Err == nil {
+			t.Errorf("item %d: expected error", i)
+		}
+	}
+}
+
+func TestReceivePayloadBatch(t *testing.T) {
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("c11n-key")
+		if key == base64.StdEncoding.EncodeToString([]byte("missing")) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("payload for " + key))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath, WithBatchConcurrency(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := [][]byte{[]byte("a"), []byte("missing"), []byte("b"), []byte("c"), []byte("d")}
+	results, err := c.ReceivePayloadBatch(context.Background(), keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, res := range results {
+		if i == 1 {
+			if res.Err == nil {
+				t.Errorf("key %d: expected error", i)
+			}
+			continue
+		}
+		want := "payload for " + base64.StdEncoding.EncodeToString(keys[i])
+		if res.Err != nil || string(res.Payload) != want {
+			t.Errorf("key %d: got %q, %v, want %q", i, res.Payload, res.Err, want)
+		}
+	}
+}
+
+func TestIsSenderBatch(t *testing.T) {
+	sent := common.BytesToEncryptedPayloadHash([]byte("sent"))
+	received := common.BytesToEncryptedPayloadHash([]byte("received"))
+	missing := common.BytesToEncryptedPayloadHash([]byte("missing"))
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/transaction/" + sent.ToBase64() + "/isSender":
+			w.Write([]byte("true"))
+		case "/transaction/" + received.ToBase64() + "/isSender":
+			w.Write([]byte("false"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath, WithBatchConcurrency(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := c.IsSenderBatch(context.Background(), []common.EncryptedPayloadHash{sent, missing, received, sent})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []bool{true, false, false, true} {
+		if i == 1 {
+			if results[i].Err == nil {
+				t.Errorf("hash %d: expected error", i)
+			}
+			continue
+		}
+		if results[i].Err != nil || results[i].IsSender != want {
+			t.Errorf("hash %d: got %t, %v, want %t", i, results[i].IsSender, results[i].Err, want)
+		}
+	}
+}
+
+func TestSendPayloadAsync(t *testing.T) {
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pl, _ := ioutil.ReadAll(r.Body)
+		if string(pl) == "fail" {
+			http.Error(w, "failure", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(common.BytesToEncryptedPayloadHash(pl).ToBase64()))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payloads := []string{"a", "fail", "b"}
+	pending := make([]<-chan SendResult, len(payloads))
+	for i, pl := range payloads {
+		pending[i] = c.SendPayloadAsync(context.Background(), []byte(pl), "", []string{testRecipient})
+	}
+	for i, result := range pending {
+		res, ok := <-result
+		if !ok {
+			t.Fatalf("send %d: channel closed without a result", i)
+		}
+		if payloads[i] == "fail" {
+			if res.Err == nil {
+				t.Errorf("send %d: expected error", i)
+			}
+		} else if want := common.BytesToEncryptedPayloadHash([]byte(payloads[i])); res.Err != nil || res.Hash != want {
+			t.Errorf("send %d: got %x, %v, want %x", i, res.Hash, res.Err, want)
+		}
+		if _, ok := <-result; ok {
+			t.Errorf("send %d: more than one result delivered", i)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// benchmarkClient returns a client for a privacy manager answering sends and
+// stores with testPayloadHash and isSender queries with "true".
+func benchmarkClient(b *testing.B) (*Client, func()) {
+	socketPath, shutdown := newTestServer(b, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/storeraw":
+			json.NewEncoder(w).Encode(&storeRawResp{Key: testPayloadHash.ToBase64()})
+		case strings.HasSuffix(r.URL.Path, "/isSender"):
+			w.Write([]byte("true"))
+		default:
+			w.Write([]byte(testPayloadHash.ToBase64()))
+		}
+	}))
+	c, err := NewClient(socketPath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return c, shutdown
+}
+
+func BenchmarkSendPayload(b *testing.B) {
+	c, shutdown := benchmarkClient(b)
+	defer shutdown()
+	payload := make([]byte, 4096)
+	to := []string{testRecipient}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.SendPayload(context.Background(), payload, "", to); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStorePayload(b *testing.B) {
+	c, shutdown := benchmarkClient(b)
+	defer shutdown()
+	payload := make([]byte, 4096)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.StorePayload(context.Background(), payload, ""); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkIsSender(b *testing.B) {
+	c, shutdown := benchmarkClient(b)
+	defer shutdown()
+	hash := common.BytesToEncryptedPayloadHash([]byte("hash"))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.IsSender(context.Background(), hash); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
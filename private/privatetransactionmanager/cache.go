@@ -0,0 +1,147 @@
+package privatetransactionmanager
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/hashicorp/golang-lru/simplelru"
+)
+
+// payloadCache is a thread-safe LRU cache of received payloads, bounded by
+// both the number of entries and their total size. Its methods are no-ops on
+// a nil receiver, so clients without a cache need no special casing.
+type payloadCache struct {
+	mu       sync.Mutex
+	lru      *simplelru.LRU
+	size     int // total size of the cached payloads in bytes
+	maxBytes int
+}
+
+// newPayloadCache creates a cache holding at most maxEntries payloads of
+// maxBytes total size. A limit of zero means no limit.
+func newPayloadCache(maxEntries, maxBytes int) *payloadCache {
+	if maxEntries <= 0 {
+		maxEntries = int(^uint32(0) >> 1)
+	}
+	if maxBytes <= 0 {
+		maxBytes = int(^uint(0) >> 1)
+	}
+	c := &payloadCache{maxBytes: maxBytes}
+	c.lru, _ = simplelru.NewLRU(maxEntries, func(_, value interface{}) {
+		c.size -= len(value.([]byte))
+	})
+	return c
+}
+
+// get returns a copy of the payload cached under key.
+func (c *payloadCache) get(key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pl, ok := c.lru.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return common.CopyBytes(pl.([]byte)), true
+}
+
+// add caches a copy of pl under key, evicting the least recently used
+// payloads as needed. Payloads larger than the whole cache are not cached.
+func (c *payloadCache) add(key string, pl []byte) {
+	if c == nil || len(pl) > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Remove(key)
+	for c.size+len(pl) > c.maxBytes {
+		c.lru.RemoveOldest()
+	}
+	c.lru.Add(key, common.CopyBytes(pl))
+	c.size += len(pl)
+}
+
+// purge empties the cache.
+func (c *payloadCache) purge() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Purge()
+}
+
+// defaultTxInfoCacheEntries bounds the transaction details cache unless
+// WithTxInfoCache sets a limit. The payload hashes asked about come from
+// transactions, so the cache must not grow with whatever is sent to the node.
+const defaultTxInfoCacheEntries = 10000
+
+// txInfoCache holds the answers to IsSender and GetParticipants, which never
+// change for a given payload, for a limited time. It keeps at most a fixed
+// number of answers, evicting the least recently used. Its methods are no-ops
+// on a nil receiver.
+type txInfoCache struct {
+	mu  sync.Mutex
+	lru *simplelru.LRU
+	ttl time.Duration
+}
+
+type txInfoEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// newTxInfoCache creates a cache holding up to maxEntries answers for ttl. A
+// limit of zero means defaultTxInfoCacheEntries.
+func newTxInfoCache(ttl time.Duration, maxEntries int) *txInfoCache {
+	if maxEntries <= 0 {
+		maxEntries = defaultTxInfoCacheEntries
+	}
+	lru, _ := simplelru.NewLRU(maxEntries, nil)
+	return &txInfoCache{lru: lru, ttl: ttl}
+}
+
+func (c *txInfoCache) get(key string) (interface{}, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v, ok := c.lru.Get(key)
+	if !ok {
+		return nil, false
+	}
+	entry := v.(*txInfoEntry)
+	if time.Now().After(entry.expires) {
+		c.lru.Remove(key)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (c *txInfoCache) set(key string, value interface{}) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Add(key, &txInfoEntry{value: value, expires: time.Now().Add(c.ttl)})
+}
+
+func (c *txInfoCache) flush() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Purge()
+}
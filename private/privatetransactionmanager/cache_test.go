@@ -0,0 +1,129 @@
+package privatetransactionmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestPayloadCacheEviction(t *testing.T) {
+	c := newPayloadCache(2, 10)
+	c.add("a", []byte("aaaa"))
+	c.add("b", []byte("bbbb"))
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("a missing from cache")
+	}
+	// The byte budget forces out b, the least recently used entry.
+	c.add("c", []byte("cccc"))
+	if _, ok := c.get("b"); ok {
+		t.Fatal("b still cached beyond the byte budget")
+	}
+	// The entry limit forces out a.
+	c.add("d", []byte("d"))
+	if _, ok := c.get("a"); ok {
+		t.Fatal("a still cached beyond the entry limit")
+	}
+	c.add("huge", make([]byte, 11))
+	if _, ok := c.get("huge"); ok {
+		t.Fatal("payload larger than the cache was cached")
+	}
+	if c.size != 5 {
+		t.Fatalf("cache size %d, want 5", c.size)
+	}
+}
+
+func TestReceivePayloadCache(t *testing.T) {
+	var calls int32
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte("payload"))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath, WithPayloadCache(10, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		pl, err := c.ReceivePayload(context.Background(), []byte("key"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(pl) != "payload" {
+			t.Fatalf("got payload %q, want %q", pl, "payload")
+		}
+		pl[0] = 'X' // must not corrupt the cached copy
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("privacy manager was asked %d times, want once", n)
+	}
+}
+
+func TestTxInfoCache(t *testing.T) {
+	var calls int32
+	alice := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, publicKeyLength))
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if strings.HasSuffix(r.URL.Path, "/isSender") {
+			w.Write([]byte("true"))
+			return
+		}
+		w.Write([]byte(alice))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath, WithTxInfoCache(time.Minute, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	txHash := common.BytesToEncryptedPayloadHash([]byte("hash"))
+	for i := 0; i < 3; i++ {
+		if isSender, err := c.IsSender(context.Background(), txHash); err != nil || !isSender {
+			t.Fatalf("got isSender %t, %v", isSender, err)
+		}
+		participants, err := c.GetParticipants(context.Background(), txHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(participants) != 1 || participants[0] != PublicKey(alice) {
+			t.Fatalf("got participants %v, want [%s]", participants, alice)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("privacy manager was asked %d times, want 2", n)
+	}
+	c.ClearCache()
+	if _, err := c.IsSender(context.Background(), txHash); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Fatalf("cleared cache answered IsSender")
+	}
+}
+
+func TestTxInfoCacheLimits(t *testing.T) {
+	c := newTxInfoCache(time.Minute, 2)
+	c.set("a", true)
+	c.set("b", true)
+	c.get("a") // keeps a, the least recently used is now b
+	c.set("c", true)
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok := c.get(key); ok != want {
+			t.Errorf("%s cached: %t, want %t", key, ok, want)
+		}
+	}
+
+	c = newTxInfoCache(10*time.Millisecond, 0)
+	c.set("a", true)
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := c.get("a"); ok {
+		t.Error("expired answer still cached")
+	}
+}
@@ -0,0 +1,115 @@
+package privatetransactionmanager
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// compressRequest replaces the body of req with its gzip compressed form.
+// Replayable bodies are compressed up front so that they can still be replayed
+// on retries, others are compressed while they are streamed.
+func compressRequest(req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	req.Header.Set("Content-Encoding", "gzip")
+	if req.GetBody == nil {
+		req.Body = compressStream(req.Body)
+		req.ContentLength = -1
+		return nil
+	}
+	buf := new(bytes.Buffer)
+	zw := gzip.NewWriter(buf)
+	if _, err := io.Copy(zw, req.Body); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	req.Body.Close()
+
+	compressed := buf.Bytes()
+	req.Body = ioutil.NopCloser(bytes.NewReader(compressed))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(compressed)), nil
+	}
+	req.ContentLength = int64(len(compressed))
+	return nil
+}
+
+// compressStream returns a reader yielding the gzip compressed contents of
+// body, which is closed once it has been consumed or the reader is closed.
+func compressStream(body io.ReadCloser) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		zw := gzip.NewWriter(pw)
+		_, err := io.Copy(zw, body)
+		if err == nil {
+			err = zw.Close()
+		}
+		body.Close()
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// decompressResponse transparently decompresses the body of res if it is gzip
+// or deflate encoded, whether compression was requested or not: proxies in
+// front of the privacy manager may compress responses on their own.
+// Responses with any other encoding are left alone.
+func decompressResponse(res *http.Response) error {
+	var (
+		zr  io.ReadCloser
+		err error
+	)
+	switch strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		zr, err = gzip.NewReader(res.Body)
+	case "deflate":
+		zr, err = newDeflateReader(res.Body)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	res.Body = &decodedBody{ReadCloser: zr, body: res.Body}
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	return nil
+}
+
+// newDeflateReader decompresses a deflate encoded body. The encoding is meant
+// to be zlib wrapped, but some servers send raw deflate data instead, so the
+// zlib header is only expected if present.
+func newDeflateReader(body io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(body)
+	header, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+// decodedBody reads a decompressed response body, closing the underlying body
+// when closed.
+type decodedBody struct {
+	io.ReadCloser
+	body io.ReadCloser
+}
+
+func (b *decodedBody) Close() error {
+	b.ReadCloser.Close()
+	return b.body.Close()
+}
@@ -0,0 +1,138 @@
+package privatetransactionmanager
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	var received string
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			http.Error(w, "compression not requested", http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Path {
+		case "/sendraw":
+			if r.Header.Get("Content-Encoding") != "gzip" {
+				http.Error(w, "uncompressed request", http.StatusBadRequest)
+				return
+			}
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			pl, _ := ioutil.ReadAll(zr)
+			received = string(pl)
+			w.Write([]byte(testPayloadHash.ToBase64()))
+		case "/receiveraw":
+			if r.Header.Get("c11n-key") == "dW5jb21wcmVzc2Vk" {
+				w.Write([]byte("uncompressed"))
+				return
+			}
+			w.Header().Set("Content-Encoding", "gzip")
+			zw := gzip.NewWriter(w)
+			zw.Write([]byte("compressed"))
+			zw.Close()
+		}
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath, WithCompression())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SendPayload(context.Background(), []byte("payload"), "", []string{testRecipient}); err != nil {
+		t.Fatal(err)
+	}
+	if received != "payload" {
+		t.Fatalf("server received payload %q, want %q", received, "payload")
+	}
+	for _, want := range []string{"compressed", "uncompressed"} {
+		pl, err := c.ReceivePayload(context.Background(), []byte(want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(pl) != want {
+			t.Fatalf("got payload %q, want %q", pl, want)
+		}
+	}
+}
+
+func TestCompressionStreaming(t *testing.T) {
+	var received string
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		pl, _ := ioutil.ReadAll(zr)
+		received = string(pl)
+		w.Write([]byte(testPayloadHash.ToBase64()))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath, WithCompression())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Wrapping the reader hides its type, so the payload is not replayable.
+	r := ioutil.NopCloser(strings.NewReader("payload"))
+	if _, err := c.SendPayloadReader(context.Background(), r, -1, "", []string{testRecipient}); err != nil {
+		t.Fatal(err)
+	}
+	if received != "payload" {
+		t.Fatalf("server received payload %q, want %q", received, "payload")
+	}
+}
+
+func TestDecompressUnrequested(t *testing.T) {
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Play a proxy that compresses responses however it sees fit.
+		var zw io.WriteCloser
+		switch r.Header.Get("c11n-key") {
+		case "Z3ppcA==": // gzip
+			w.Header().Set("Content-Encoding", "gzip")
+			zw = gzip.NewWriter(w)
+		case "emxpYg==": // zlib
+			w.Header().Set("Content-Encoding", "deflate")
+			zw = zlib.NewWriter(w)
+		case "ZmxhdGU=": // flate
+			w.Header().Set("Content-Encoding", "Deflate")
+			zw, _ = flate.NewWriter(w, flate.DefaultCompression)
+		default:
+			w.Write([]byte("identity"))
+			return
+		}
+		zw.Write([]byte("compressed"))
+		zw.Close()
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, encoding := range []string{"gzip", "zlib", "flate", "identity"} {
+		want := "compressed"
+		if encoding == "identity" {
+			want = "identity"
+		}
+		pl, err := c.ReceivePayload(context.Background(), []byte(encoding))
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		if string(pl) != want {
+			t.Fatalf("%s: got payload %q, want %q", encoding, pl, want)
+		}
+	}
+}
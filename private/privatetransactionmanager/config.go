@@ -1,20 +1,39 @@
 package privatetransactionmanager
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
 	"github.com/BurntSushi/toml"
 )
 
 type Config struct {
 	Socket  string `toml:"socket"`
 	WorkDir string `toml:"workdir"`
+	Storage string `toml:"storage"`
 
 	// Deprecated
 	SocketPath string `toml:"socketPath"`
 }
 
+// LoadConfig reads a Constellation TOML configuration or, if the file holds a
+// JSON object, a Tessera configuration. Of the latter only the socket is used:
+// the address of the Q2T server, or the older unixSocketFile setting.
 func LoadConfig(configPath string) (*Config, error) {
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return parseTesseraConfig(trimmed)
+	}
 	cfg := new(Config)
-	if _, err := toml.DecodeFile(configPath, cfg); err != nil {
+	if _, err := toml.Decode(string(data), cfg); err != nil {
 		return nil, err
 	}
 	// Fall back to Constellation 0.0.1 config format if necessary
@@ -23,3 +42,76 @@ func LoadConfig(configPath string) (*Config, error) {
 	}
 	return cfg, nil
 }
+
+// tesseraConfig holds the parts of a Tessera configuration the client uses.
+type tesseraConfig struct {
+	UnixSocketFile string `json:"unixSocketFile"`
+	ServerConfigs  []struct {
+		App           string `json:"app"`
+		ServerAddress string `json:"serverAddress"`
+	} `json:"serverConfigs"`
+}
+
+func parseTesseraConfig(data []byte) (*Config, error) {
+	var tcfg tesseraConfig
+	if err := json.Unmarshal(data, &tcfg); err != nil {
+		return nil, err
+	}
+	cfg := &Config{Socket: tcfg.UnixSocketFile}
+	for _, server := range tcfg.ServerConfigs {
+		if strings.EqualFold(server.App, "Q2T") && strings.HasPrefix(server.ServerAddress, "unix:") {
+			cfg.Socket = strings.TrimPrefix(server.ServerAddress, "unix:")
+		}
+	}
+	return cfg, nil
+}
+
+// SocketFile returns the path of the configured socket, resolved against the
+// working directory unless it names an abstract socket.
+func (c *Config) SocketFile() string {
+	if isAbstractSocket(c.Socket) {
+		return c.Socket
+	}
+	return filepath.Join(c.WorkDir, c.Socket)
+}
+
+// ValidateConfig checks that the node configuration file at cfgPath, for
+// Constellation or Tessera, can be read and parsed, and that it configures the socket the node listens on and,
+// if set, a storage location. LaunchNode runs the same checks before starting
+// a node, so that a broken configuration is reported instead of a node that
+// exits right away.
+func ValidateConfig(cfgPath string) error {
+	_, err := loadValidConfig(cfgPath)
+	return err
+}
+
+// loadValidConfig loads the configuration at cfgPath and validates it like
+// ValidateConfig.
+func loadValidConfig(cfgPath string) (*Config, error) {
+	fi, err := os.Stat(cfgPath)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("privacy manager config %s is not a regular file", cfgPath)
+	}
+	cfg, err := LoadConfig(cfgPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid privacy manager config %s: %v", cfgPath, err)
+	}
+	if cfg.Socket == "" {
+		return nil, fmt.Errorf("privacy manager config %s has no socket", cfgPath)
+	}
+	// Constellation defaults to "dir:storage", but the location of an explicit
+	// setting such as "leveldb:" must not be empty.
+	if cfg.Storage != "" {
+		storage := cfg.Storage
+		if i := strings.IndexByte(storage, ':'); i >= 0 {
+			storage = storage[i+1:]
+		}
+		if storage == "" {
+			return nil, fmt.Errorf("privacy manager config %s has an empty storage location %q", cfgPath, cfg.Storage)
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,49 @@
+package privatetransactionmanager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ptm-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name, config string
+		ok           bool
+	}{
+		{"valid", "socket = \"tm.ipc\"\nworkdir = \"data\"\nstorage = \"dir:storage\"\n", true},
+		{"legacy", "socketPath = \"tm.ipc\"\n", true},
+		{"no-socket", "workdir = \"data\"\n", false},
+		{"empty-storage", "socket = \"tm.ipc\"\nstorage = \"leveldb:\"\n", false},
+		{"malformed", "socket = \n", false},
+		{"tessera", `{"serverConfigs": [{"app": "ThirdParty", "serverAddress": "http://localhost:9081"}, {"app": "Q2T", "serverAddress": "unix:/tmp/tm.ipc"}]}`, true},
+		{"tessera-legacy", `{"unixSocketFile": "/tmp/tm.ipc"}`, true},
+		{"tessera-no-socket", `{"serverConfigs": [{"app": "P2P", "serverAddress": "http://localhost:9000"}]}`, false},
+		{"tessera-malformed", `{"unixSocketFile": `, false},
+	}
+	for _, test := range tests {
+		cfgPath := filepath.Join(dir, test.name+".conf")
+		if err := ioutil.WriteFile(cfgPath, []byte(test.config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := ValidateConfig(cfgPath); (err == nil) != test.ok {
+			t.Errorf("%s: got error %v, want ok %t", test.name, err, test.ok)
+		}
+	}
+	if err := ValidateConfig(filepath.Join(dir, "missing.conf")); err == nil {
+		t.Error("expected error for missing config")
+	}
+	if err := ValidateConfig(dir); err == nil {
+		t.Error("expected error for directory")
+	}
+	if _, err := LaunchNode(os.Args[0], filepath.Join(dir, "no-socket.conf")); err == nil {
+		t.Error("expected LaunchNode to reject invalid config")
+	}
+}
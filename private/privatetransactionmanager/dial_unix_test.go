@@ -0,0 +1,50 @@
+// +build !windows
+
+package privatetransactionmanager
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestDialTimeout(t *testing.T) {
+	// A listener that never accepts, with a backlog of one: once it is full,
+	// further connection attempts hang.
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fd)
+	if err := syscall.Bind(fd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Listen(fd, 0); err != nil {
+		t.Fatal(err)
+	}
+	sa, err := syscall.Getsockname(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := fmt.Sprintf("127.0.0.1:%d", sa.(*syscall.SockaddrInet4).Port)
+	if conn, err := net.Dial("tcp", addr); err == nil {
+		defer conn.Close()
+	}
+
+	c, err := NewClientFromURL("http://"+addr, WithDialTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = c.GetVersion(context.Background())
+	if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		t.Fatalf("got error %v, want dial timeout", err)
+	}
+	// The request timeout of 5s would have taken longer.
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("dial timeout took %v", elapsed)
+	}
+}
@@ -0,0 +1,90 @@
+package privatetransactionmanager
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// redacted replaces the values hidden from request dumps.
+const redacted = "<redacted>"
+
+// redactedHeaders are the headers carrying key material or credentials, whose
+// values are hidden from request dumps unless WithUnsafeRequestDump is used.
+var redactedHeaders = map[string]bool{
+	"C11n-From":                 true,
+	"C11n-To":                   true,
+	"C11n-Key":                  true,
+	"C11n-Mandatory-Recipients": true,
+	"C11n-Privacy-Group-Id":     true,
+	"Authorization":             true,
+}
+
+// dumpTransport logs the request line and headers of every request it sends,
+// and the status and headers of the response, for diagnosing how a privacy
+// manager handles the client's requests. Bodies are never logged.
+type dumpTransport struct {
+	next   http.RoundTripper
+	logger log.Logger
+	unsafe bool // log key material instead of redacting it
+}
+
+func (t *dumpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	uri := t.requestURI(req.URL)
+	t.logger.Info("Privacy manager request dump", "request", req.Method+" "+uri+" "+req.Proto,
+		"host", req.URL.Host, "length", req.ContentLength, "header", t.formatHeader(req.Header))
+
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+	elapsed := common.PrettyDuration(time.Since(start))
+	if err != nil {
+		t.logger.Info("Privacy manager response dump", "request", req.Method+" "+uri, "elapsed", elapsed, "err", err)
+		return nil, err
+	}
+	t.logger.Info("Privacy manager response dump", "request", req.Method+" "+uri, "elapsed", elapsed,
+		"status", res.Status, "length", res.ContentLength, "header", t.formatHeader(res.Header))
+	return res, nil
+}
+
+// requestURI returns the path and query of u, with the query values, such as
+// a recipient key, redacted.
+func (t *dumpTransport) requestURI(u *url.URL) string {
+	if t.unsafe || u.RawQuery == "" {
+		return u.RequestURI()
+	}
+	query := u.Query()
+	for _, values := range query {
+		for i := range values {
+			values[i] = redacted
+		}
+	}
+	redactedURL := *u
+	redactedURL.RawQuery = query.Encode()
+	return redactedURL.RequestURI()
+}
+
+// formatHeader renders h on a single line, sorted by name, with the values of
+// redactedHeaders hidden.
+func (t *dumpTransport) formatHeader(h http.Header) string {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]string, 0, len(names))
+	for _, name := range names {
+		value := strings.Join(h[name], ",")
+		if !t.unsafe && redactedHeaders[http.CanonicalHeaderKey(name)] {
+			value = redacted
+		}
+		fields = append(fields, fmt.Sprintf("%s: %s", name, value))
+	}
+	return strings.Join(fields, "; ")
+}
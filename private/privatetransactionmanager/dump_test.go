@@ -0,0 +1,75 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+func TestRequestDump(t *testing.T) {
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Node", "tessera")
+		w.Write([]byte(testPayloadHash.ToBase64()))
+	}))
+	defer shutdown()
+
+	sender := testKey(2)
+	dump := func(opt Option) string {
+		t.Helper()
+		logger, records := recordingLogger()
+		c, err := NewClient(socketPath, WithLogger(logger), opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.SendPayload(context.Background(), []byte("secret payload"), sender, []string{testRecipient}); err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, r := range records() {
+			if strings.HasSuffix(r.Msg, "dump") && r.Lvl == log.LvlInfo {
+				out = append(out, fmt.Sprint(r.Msg, r.Ctx))
+			}
+		}
+		if len(out) != 2 {
+			t.Fatalf("got %d dump records, want 2: %v", len(out), out)
+		}
+		return strings.Join(out, "\n")
+	}
+
+	out := dump(WithRequestDump())
+	for _, want := range []string{"POST /sendraw HTTP/1.1", "C11n-To: " + redacted, "C11n-From: " + redacted, "200 OK", "X-Node: tessera"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("dump lacks %q:\n%s", want, out)
+		}
+	}
+	for _, secret := range []string{testRecipient, sender, "secret payload"} {
+		if strings.Contains(out, secret) {
+			t.Fatalf("dump leaks %q:\n%s", secret, out)
+		}
+	}
+
+	out = dump(WithUnsafeRequestDump())
+	for _, want := range []string{"C11n-To: " + testRecipient, "C11n-From: " + sender} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("unsafe dump lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "secret payload") {
+		t.Fatalf("unsafe dump leaks the payload:\n%s", out)
+	}
+}
+
+func TestRequestDumpQuery(t *testing.T) {
+	dt := &dumpTransport{}
+	req, err := http.NewRequest("GET", "http://ptm/transaction/abc?to="+testRecipient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := dt.requestURI(req.URL), "/transaction/abc?to=%3Credacted%3E"; got != want {
+		t.Fatalf("got request URI %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,87 @@
+package privatetransactionmanager
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// maxStatusMessageLength bounds how much of an error response body is kept
+// in a StatusError.
+const maxStatusMessageLength = 256
+
+// ErrPayloadNotFound is returned when the privacy manager holds no payload for
+// the requested key.
+var ErrPayloadNotFound = errors.New("payload not found")
+
+// ErrPayloadExists is returned by Push when the privacy manager already holds
+// the pushed payload.
+var ErrPayloadExists = errors.New("payload already exists")
+
+// ErrEmptyPayload is returned by ReceivePayload, if payload verification is
+// enabled, when the privacy manager answers with an empty payload.
+var ErrEmptyPayload = errors.New("privacy manager returned an empty payload")
+
+// ErrNoRecipients is returned by sends that need recipients, such as those
+// with mandatory recipients, when none are given.
+var ErrNoRecipients = errors.New("no recipients")
+
+// ErrConcurrencyLimit is returned by calls made while the client has as many
+// requests in progress as WithMaxInFlight allows, if they may not wait.
+var ErrConcurrencyLimit = errors.New("too many privacy manager requests in progress")
+
+// ErrClientClosed is returned by calls made with a closed Client, and by those
+// interrupted by closing it.
+var ErrClientClosed = errors.New("privacy manager client closed")
+
+// ErrPrivacyGroupNotFound is returned when the privacy manager knows no
+// privacy group with the requested id.
+var ErrPrivacyGroupNotFound = errors.New("privacy group not found")
+
+// StatusError is returned when the privacy manager answers a request with a
+// status code outside the 2xx range. Use errors.As to inspect the code.
+//
+// The error string only names the status. Privacy managers echo keys and other
+// request details in their error responses, so the response body is kept in
+// Message for callers that want it, but never ends up in logs by accident.
+type StatusError struct {
+	Code    int    // HTTP status code of the response
+	Message string // start of the response body, if any
+}
+
+func (e *StatusError) Error() string {
+	if text := http.StatusText(e.Code); text != "" {
+		return fmt.Sprintf("privacy manager returned status %d %s", e.Code, text)
+	}
+	return fmt.Sprintf("privacy manager returned status %d", e.Code)
+}
+
+// newStatusError creates the error for an unexpected response, consuming and
+// closing its body.
+func newStatusError(res *http.Response) *StatusError {
+	msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxStatusMessageLength))
+	drainAndClose(res)
+	return &StatusError{
+		Code:    res.StatusCode,
+		Message: strings.TrimSpace(string(msg)),
+	}
+}
+
+// PayloadTooLargeError is returned when a payload exceeds the size limit set
+// with WithMaxPayloadSize. It is detected before the payload is sent, except
+// for streamed payloads of unknown size, which are aborted once they exceed
+// the limit.
+type PayloadTooLargeError struct {
+	Size  int64 // size of the payload, or -1 if unknown
+	Limit int64
+}
+
+func (e *PayloadTooLargeError) Error() string {
+	if e.Size < 0 {
+		return fmt.Sprintf("payload exceeds the maximum size of %d bytes", e.Limit)
+	}
+	return fmt.Sprintf("payload of %d bytes exceeds the maximum size of %d bytes", e.Size, e.Limit)
+}
@@ -0,0 +1,43 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestStatusError(t *testing.T) {
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Secret", "do-not-log")
+		http.Error(w, "Recipient not found for key: "+testRecipient, http.StatusNotFound)
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.SendPayload(context.Background(), []byte("payload"), "", []string{testRecipient})
+
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("got error %v, want *StatusError", err)
+	}
+	if statusErr.Code != http.StatusNotFound {
+		t.Fatalf("got status %d, want %d", statusErr.Code, http.StatusNotFound)
+	}
+	if strings.Contains(err.Error(), "do-not-log") {
+		t.Fatalf("error leaks response headers: %v", err)
+	}
+	if strings.Contains(err.Error(), testRecipient) {
+		t.Fatalf("error leaks response body: %v", err)
+	}
+	if want := "privacy manager returned status 404 Not Found"; err.Error() != want {
+		t.Fatalf("got error %q, want %q", err, want)
+	}
+	if want := "Recipient not found for key: " + testRecipient; statusErr.Message != want {
+		t.Fatalf("got message %q, want %q", statusErr.Message, want)
+	}
+}
@@ -0,0 +1,91 @@
+package privatetransactionmanager
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// expvarMu serialises looking up and publishing expvar maps, which panics if
+// a name is published twice.
+var expvarMu sync.Mutex
+
+// expvarCounters publishes basic counters of a Client through expvar, as an
+// expvar.Map with the keys requests, errors, bytesSent and bytesReceived.
+type expvarCounters struct {
+	requests      *expvar.Int
+	errors        *expvar.Int
+	bytesSent     *expvar.Int
+	bytesReceived *expvar.Int
+}
+
+// newExpvarCounters publishes the counters under name. Clients given the same
+// name share the counters instead of clashing, but a name published as
+// something other than a map, such as "memstats", is rejected.
+func newExpvarCounters(name string) (*expvarCounters, error) {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+
+	var m *expvar.Map
+	switch v := expvar.Get(name).(type) {
+	case nil:
+		m = expvar.NewMap(name)
+	case *expvar.Map:
+		m = v
+	default:
+		return nil, fmt.Errorf("expvar %q is already published as %T", name, v)
+	}
+	counter := func(key string) *expvar.Int {
+		if v, ok := m.Get(key).(*expvar.Int); ok {
+			return v
+		}
+		v := new(expvar.Int)
+		m.Set(key, v)
+		return v
+	}
+	return &expvarCounters{
+		requests:      counter("requests"),
+		errors:        counter("errors"),
+		bytesSent:     counter("bytesSent"),
+		bytesReceived: counter("bytesReceived"),
+	}, nil
+}
+
+// observe counts a completed request. It is a no-op on a nil receiver.
+func (e *expvarCounters) observe(err error) {
+	if e == nil {
+		return
+	}
+	e.requests.Add(1)
+	if err != nil {
+		e.errors.Add(1)
+	}
+}
+
+// countBody counts the bytes read from a response body as received.
+func (e *expvarCounters) countBody(body io.ReadCloser) io.ReadCloser {
+	if e == nil {
+		return body
+	}
+	return &countedBody{ReadCloser: body, n: e.bytesReceived}
+}
+
+// countRequestBody counts the bytes read from a request body as sent.
+func (e *expvarCounters) countRequestBody(body io.ReadCloser) io.ReadCloser {
+	if e == nil {
+		return body
+	}
+	return &countedBody{ReadCloser: body, n: e.bytesSent}
+}
+
+type countedBody struct {
+	io.ReadCloser
+	n *expvar.Int
+}
+
+func (b *countedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
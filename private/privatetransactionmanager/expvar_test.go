@@ -0,0 +1,62 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestExpvar(t *testing.T) {
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sendraw" {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("0.10.2"))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath, WithExpvar("ptm-test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := expvar.Get("ptm-test").(*expvar.Map)
+	before := make(map[string]int64)
+	vars.Do(func(kv expvar.KeyValue) {
+		before[kv.Key] = kv.Value.(*expvar.Int).Value()
+	})
+	if _, err := c.GetVersion(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SendPayload(context.Background(), []byte("payload"), "", []string{testRecipient}); err == nil {
+		t.Fatal("expected send to fail")
+	}
+	if _, err := c.SendPayloadReader(context.Background(), strings.NewReader("streamed"), -1, "", []string{testRecipient}); err == nil {
+		t.Fatal("expected send to fail")
+	}
+	// A second client with the same name shares the counters.
+	c, err = NewClient(socketPath, WithExpvar("ptm-test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetVersion(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]int64{"requests": 4, "errors": 2, "bytesSent": 15, "bytesReceived": 12}
+	for key, n := range want {
+		if got := vars.Get(key).(*expvar.Int).Value() - before[key]; got != n {
+			t.Errorf("got %s %d, want %d", key, got, n)
+		}
+	}
+}
+
+func TestExpvarNameTaken(t *testing.T) {
+	for _, name := range []string{"memstats", "cmdline"} {
+		if _, err := NewClient("/nonexistent/tm.ipc", WithExpvar(name)); err == nil {
+			t.Errorf("expected error publishing the counters as %q", name)
+		}
+	}
+}
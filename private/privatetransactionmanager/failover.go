@@ -0,0 +1,164 @@
+package privatetransactionmanager
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// endpointRetryInterval is how long an unreachable endpoint is skipped before
+// it is tried again.
+const endpointRetryInterval = 5 * time.Second
+
+// failoverBaseURL is the base of request URLs sent through a failoverTransport,
+// which rewrites them to the endpoint chosen for each request.
+const failoverBaseURL = "http://ptm/"
+
+// endpoint is a single privacy manager instance behind a failoverTransport.
+type endpoint struct {
+	name      string // socket path or URL, for logging
+	baseURL   string
+	transport http.RoundTripper
+	downUntil time.Time // zero while the endpoint is believed to be up
+}
+
+// failoverTransport sends each request to the first endpoint, in order of
+// preference, that isn't known to be down. An endpoint is only given up on if
+// it could not be connected to, so a request is never processed by two
+// privacy managers. Once an endpoint has been down for endpointRetryInterval
+// it is tried again, so requests fail back to the preferred endpoint after it
+// has recovered.
+type failoverTransport struct {
+	endpoints []*endpoint
+	logger    log.Logger
+
+	mu sync.Mutex
+}
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var lastErr error
+	for i, ep := range t.candidates() {
+		if i > 0 {
+			// Streamed bodies have been consumed by the failed attempt.
+			if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+				return nil, lastErr
+			}
+			next, err := rewind(req)
+			if err != nil {
+				return nil, err
+			}
+			req = next
+		}
+		epReq, err := ep.request(req)
+		if err != nil {
+			return nil, err
+		}
+		res, err := ep.transport.RoundTrip(epReq)
+		if err == nil || !isDialError(err) {
+			t.markUp(ep)
+			return res, err
+		}
+		t.markDown(ep, err)
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// candidates returns the endpoints to try for a request: those that are up,
+// in order of preference, followed by those that are down. Trying down
+// endpoints last means requests are still attempted when all are down.
+func (t *failoverTransport) candidates() []*endpoint {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var up, down []*endpoint
+	now := time.Now()
+	for _, ep := range t.endpoints {
+		if ep.downUntil.After(now) {
+			down = append(down, ep)
+		} else {
+			up = append(up, ep)
+		}
+	}
+	return append(up, down...)
+}
+
+func (t *failoverTransport) markUp(ep *endpoint) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !ep.downUntil.IsZero() {
+		t.logger.Info("Privacy manager endpoint recovered", "endpoint", ep.name)
+		ep.downUntil = time.Time{}
+	}
+}
+
+func (t *failoverTransport) markDown(ep *endpoint, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if ep.downUntil.IsZero() {
+		t.logger.Warn("Privacy manager endpoint unreachable, failing over", "endpoint", ep.name, "err", err)
+	}
+	ep.downUntil = time.Now().Add(endpointRetryInterval)
+}
+
+// CloseIdleConnections closes the idle connections of all endpoints. It is
+// called by http.Client.CloseIdleConnections.
+func (t *failoverTransport) CloseIdleConnections() {
+	for _, ep := range t.endpoints {
+		if tr, ok := ep.transport.(interface{ CloseIdleConnections() }); ok {
+			tr.CloseIdleConnections()
+		}
+	}
+}
+
+// request returns a copy of req addressed to the endpoint.
+func (ep *endpoint) request(req *http.Request) (*http.Request, error) {
+	u, err := url.Parse(ep.baseURL + strings.TrimPrefix(req.URL.RequestURI(), "/"))
+	if err != nil {
+		return nil, err
+	}
+	epReq := req.Clone(req.Context())
+	epReq.URL, epReq.Host = u, ""
+	return epReq, nil
+}
+
+// NewFailoverClient creates a client for several privacy manager instances
+// sharing the same storage, in order of preference. Each endpoint is either a
+// socket path, as accepted by NewClient, or a URL, as accepted by
+// NewClientFromURL. Requests go to the most preferred endpoint that can be
+// connected to.
+func NewFailoverClient(endpoints []string, opts ...Option) (*Client, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("no privacy manager endpoints")
+	}
+	cfg := newClientConfig(opts)
+	ft := &failoverTransport{logger: cfg.logger}
+	var sockets []string
+	for _, name := range endpoints {
+		ep := &endpoint{name: name}
+		if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
+			baseURL, err := parseBaseURL(name)
+			if err != nil {
+				return nil, err
+			}
+			ep.baseURL, ep.transport = baseURL, tcpTransport(cfg)
+		} else {
+			ep.baseURL, ep.transport = unixBaseURL, unixTransport(name, cfg)
+			sockets = append(sockets, name)
+		}
+		ft.endpoints = append(ft.endpoints, ep)
+	}
+	c, err := newClient(&http.Client{Transport: ft}, failoverBaseURL, cfg)
+	if err != nil {
+		return nil, err
+	}
+	c.sockets = sockets
+	return c, nil
+}
@@ -0,0 +1,131 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// versionServer answers version requests with the given version, counting
+// the requests it receives.
+func versionServer(version string, calls *int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		w.Write([]byte(version))
+	})
+}
+
+func TestFailover(t *testing.T) {
+	var primaryCalls, secondaryCalls int32
+	primary, shutdownPrimary := newTestServer(t, versionServer("primary", &primaryCalls))
+	defer shutdownPrimary()
+	secondary := httptest.NewServer(versionServer("secondary", &secondaryCalls))
+	defer secondary.Close()
+
+	c, err := NewFailoverClient([]string{primary, secondary.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	checkVersion := func(want string) {
+		t.Helper()
+		version, err := c.GetVersion(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version != want {
+			t.Fatalf("got version %q, want %q", version, want)
+		}
+	}
+	checkVersion("primary")
+
+	// Once the primary is gone, requests fail over to the secondary without
+	// trying the primary again.
+	shutdownPrimary()
+	checkVersion("secondary")
+	checkVersion("secondary")
+	if n := atomic.LoadInt32(&primaryCalls); n != 1 {
+		t.Fatalf("primary received %d requests, want 1", n)
+	}
+
+	// Requests fail back to the primary once it has recovered and the retry
+	// interval has passed.
+	if err := os.MkdirAll(filepath.Dir(primary), 0700); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(filepath.Dir(primary))
+	l, err := net.Listen("unix", primary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted := httptest.NewUnstartedServer(versionServer("primary", &primaryCalls))
+	restarted.Listener = l
+	restarted.Start()
+	defer restarted.Close()
+
+	checkVersion("secondary")
+	ft := c.httpClient.Transport.(*failoverTransport)
+	ft.mu.Lock()
+	ft.endpoints[0].downUntil = time.Now()
+	ft.mu.Unlock()
+	checkVersion("primary")
+}
+
+func TestFailoverAllDown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ptm-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c, err := NewFailoverClient([]string{filepath.Join(dir, "a.ipc"), filepath.Join(dir, "b.ipc")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetVersion(context.Background()); err == nil {
+		t.Fatal("expected error with all endpoints down")
+	}
+	if err := c.Validate(); err == nil {
+		t.Fatal("expected validation error for missing sockets")
+	}
+}
+
+func TestFailoverValidate(t *testing.T) {
+	primary, shutdown := newTestServer(t, versionServer("primary", new(int32)))
+	defer shutdown()
+	missing := filepath.Join(filepath.Dir(primary), "missing.ipc")
+
+	logger, records := recordingLogger()
+	c, err := NewFailoverClient([]string{missing, primary}, WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("got error %v with one socket up, want none", err)
+	}
+	var warned bool
+	for _, r := range records() {
+		if r.Lvl == log.LvlWarn && r.Msg == "Privacy manager socket unavailable" {
+			warned = true
+		}
+	}
+	if !warned {
+		t.Fatal("missing socket wasn't logged")
+	}
+}
+
+func TestNewFailoverClientRejectsEmpty(t *testing.T) {
+	if _, err := NewFailoverClient(nil); err == nil {
+		t.Fatal("expected error without endpoints")
+	}
+}
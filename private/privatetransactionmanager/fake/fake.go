@@ -0,0 +1,138 @@
+// Package fake provides an in-memory stand-in for a privacy manager, so that
+// private transaction code paths can be tested without a running
+// constellation-node.
+package fake
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/private/privatetransactionmanager"
+)
+
+// ErrNotFound is returned for payload hashes the fake has never stored. It is
+// the real client's privatetransactionmanager.ErrPayloadNotFound, so that code
+// tested against the fake handles unknown payloads as it would in production.
+var ErrNotFound = privatetransactionmanager.ErrPayloadNotFound
+
+type transaction struct {
+	payload []byte
+	from    string
+	to      []string
+}
+
+// Client is an in-memory privacy manager. Payloads are kept in a map keyed by
+// a hash derived from their content, and senders are checked against the set
+// of keys the fake was created with.
+type Client struct {
+	ownKeys []string
+
+	mu  sync.RWMutex
+	txs map[common.EncryptedPayloadHash]*transaction
+	seq uint64
+}
+
+var _ privatetransactionmanager.Node = (*Client)(nil)
+
+// NewClient creates an empty fake privacy manager holding the given public
+// keys. The first key is used as the sender when none is specified.
+func NewClient(ownKeys ...string) *Client {
+	return &Client{
+		ownKeys: ownKeys,
+		txs:     make(map[common.EncryptedPayloadHash]*transaction),
+	}
+}
+
+func (c *Client) store(pl []byte, from string, to []string) common.EncryptedPayloadHash {
+	if from == "" && len(c.ownKeys) > 0 {
+		from = c.ownKeys[0]
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Like real encryption, storing the same payload twice yields two
+	// distinct hashes.
+	c.seq++
+	var nonce [8]byte
+	binary.BigEndian.PutUint64(nonce[:], c.seq)
+	hash := common.BytesToEncryptedPayloadHash(crypto.Keccak512(pl, nonce[:]))
+
+	c.txs[hash] = &transaction{
+		payload: common.CopyBytes(pl),
+		from:    from,
+		to:      append([]string(nil), to...),
+	}
+	return hash
+}
+
+func (c *Client) lookup(hash common.EncryptedPayloadHash) (*transaction, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	tx, ok := c.txs[hash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return tx, nil
+}
+
+func (c *Client) SendPayload(ctx context.Context, pl []byte, b64From string, b64To []string) (common.EncryptedPayloadHash, error) {
+	return c.store(pl, b64From, b64To), nil
+}
+
+func (c *Client) StorePayload(ctx context.Context, pl []byte, b64From string) ([]byte, error) {
+	return c.store(pl, b64From, nil).Bytes(), nil
+}
+
+// SendSignedPayload distributes a payload previously stored with StorePayload,
+// identified by its hash, to the given recipients.
+func (c *Client) SendSignedPayload(ctx context.Context, signedPayload []byte, b64To []string) ([]byte, error) {
+	hash := common.BytesToEncryptedPayloadHash(signedPayload)
+	tx, err := c.lookup(hash)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	tx.to = append([]string(nil), b64To...)
+	c.mu.Unlock()
+	return hash.Bytes(), nil
+}
+
+func (c *Client) ReceivePayload(ctx context.Context, key []byte) ([]byte, error) {
+	tx, err := c.lookup(common.BytesToEncryptedPayloadHash(key))
+	if err != nil {
+		return nil, err
+	}
+	return common.CopyBytes(tx.payload), nil
+}
+
+// IsSender reports whether the payload was sent from one of the fake's own keys.
+func (c *Client) IsSender(ctx context.Context, txHash common.EncryptedPayloadHash) (bool, error) {
+	tx, err := c.lookup(txHash)
+	if err != nil {
+		return false, err
+	}
+	for _, key := range c.ownKeys {
+		if key == tx.from {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (c *Client) GetParticipants(ctx context.Context, txHash common.EncryptedPayloadHash) ([]privatetransactionmanager.PublicKey, error) {
+	tx, err := c.lookup(txHash)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	participants := make([]privatetransactionmanager.PublicKey, len(tx.to))
+	for i, to := range tx.to {
+		participants[i] = privatetransactionmanager.PublicKey(to)
+	}
+	return participants, nil
+}
@@ -0,0 +1,77 @@
+package fake
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/private/privatetransactionmanager"
+)
+
+func TestSendReceive(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient("ours")
+
+	txHash, err := c.SendPayload(ctx, []byte("payload"), "", []string{"alice", "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pl, err := c.ReceivePayload(ctx, txHash.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pl, []byte("payload")) {
+		t.Fatalf("got payload %q, want %q", pl, "payload")
+	}
+	isSender, err := c.IsSender(ctx, txHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isSender {
+		t.Fatal("expected payload sent with the default key to be ours")
+	}
+	participants, err := c.GetParticipants(ctx, txHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []privatetransactionmanager.PublicKey{"alice", "bob"}; !reflect.DeepEqual(participants, want) {
+		t.Fatalf("got participants %v, want %v", participants, want)
+	}
+}
+
+func TestIsSenderForeignKey(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient("ours")
+
+	txHash, _ := c.SendPayload(ctx, []byte("payload"), "theirs", []string{"ours"})
+	isSender, err := c.IsSender(ctx, txHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isSender {
+		t.Fatal("payload from a foreign key reported as ours")
+	}
+}
+
+func TestStoreThenSendSigned(t *testing.T) {
+	ctx := context.Background()
+	c := NewClient("ours")
+
+	hash, _ := c.StorePayload(ctx, []byte("payload"), "")
+	if _, err := c.SendSignedPayload(ctx, hash, []string{"alice"}); err != nil {
+		t.Fatal(err)
+	}
+	participants, _ := c.GetParticipants(ctx, common.BytesToEncryptedPayloadHash(hash))
+	if want := []privatetransactionmanager.PublicKey{"alice"}; !reflect.DeepEqual(participants, want) {
+		t.Fatalf("got participants %v, want %v", participants, want)
+	}
+}
+
+func TestReceiveUnknown(t *testing.T) {
+	if _, err := NewClient().ReceivePayload(context.Background(), []byte("unknown")); err != privatetransactionmanager.ErrPayloadNotFound {
+		t.Fatalf("got error %v, want %v", err, privatetransactionmanager.ErrPayloadNotFound)
+	}
+}
@@ -0,0 +1,237 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Health is the outcome of a privacy manager health check.
+type Health struct {
+	Up         bool          // whether the privacy manager reported itself up
+	StatusCode int           // HTTP status code of the upcheck response
+	Latency    time.Duration // time taken to answer the upcheck
+	Body       []byte        // upcheck response body, e.g. "I'm up!"
+}
+
+// HealthCheck queries the privacy manager's upcheck endpoint. An error is only
+// returned if the privacy manager could not be reached at all; a node that
+// answers with an error status is reported as down.
+func (c *Client) HealthCheck(ctx context.Context) (*Health, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.requestURL("upcheck"), nil)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	res, err := c.do(opUpcheck, req)
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return &Health{
+			StatusCode: statusErr.Code,
+			Latency:    time.Since(start),
+			Body:       []byte(statusErr.Message),
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &Health{
+		Up:         true,
+		StatusCode: res.StatusCode,
+		Latency:    time.Since(start),
+		Body:       body,
+	}, nil
+}
+
+// WaitUntilUp polls the privacy manager's upcheck every interval until it
+// reports itself up. After timeout has elapsed, the error of the last upcheck
+// is returned; a timeout of zero means waiting until ctx is done, in which
+// case the context's error is returned.
+func (c *Client) WaitUntilUp(ctx context.Context, interval, timeout time.Duration) error {
+	pollCtx, cancel := ctx, context.CancelFunc(func() {})
+	if timeout > 0 {
+		pollCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+
+	var lastErr error
+	for {
+		health, err := c.HealthCheck(pollCtx)
+		if err == nil && health.Up {
+			return nil
+		}
+		if err == nil {
+			err = fmt.Errorf("upcheck returned status %d", health.StatusCode)
+		}
+		// Prefer the error of a completed upcheck over the one caused by
+		// the timeout interrupting the last attempt.
+		if pollCtx.Err() == nil || lastErr == nil {
+			lastErr = err
+		}
+		timer := time.NewTimer(interval)
+		select {
+		case <-pollCtx.Done():
+			timer.Stop()
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return lastErr
+		case <-timer.C:
+		}
+	}
+}
+
+// HealthEvent reports a change in the health of the privacy manager.
+type HealthEvent struct {
+	Up     bool      // whether the privacy manager is up
+	Health *Health   // outcome of the upcheck, nil if it could not be reached
+	Err    error     // why the privacy manager is down, nil if it is up
+	Time   time.Time // when the upcheck completed
+}
+
+// minHealthInterval is the shortest interval between the upchecks of a
+// health monitor.
+const minHealthInterval = 10 * time.Millisecond
+
+// StartHealthMonitor runs the privacy manager's upcheck every interval in the
+// background, and reports on the returned channel its initial health and
+// every time it goes down or comes back up afterwards. Events are not
+// dropped: the monitor waits for each event to be received before checking
+// again. The monitor stops, closing the channel, once ctx is done or the
+// client is closed. Intervals shorter than 10ms are raised to 10ms.
+func (c *Client) StartHealthMonitor(ctx context.Context, interval time.Duration) <-chan HealthEvent {
+	if interval < minHealthInterval {
+		interval = minHealthInterval
+	}
+	events := make(chan HealthEvent)
+	go func() {
+		defer close(events)
+
+		first := true
+		var up bool
+		for {
+			health, err := c.HealthCheck(ctx)
+			if ctx.Err() != nil || c.inflight.closed() {
+				return
+			}
+			if err == nil && !health.Up {
+				err = fmt.Errorf("upcheck returned status %d", health.StatusCode)
+			}
+			if first || up != (err == nil) {
+				first, up = false, err == nil
+				select {
+				case events <- HealthEvent{Up: up, Health: health, Err: err, Time: time.Now()}:
+				case <-ctx.Done():
+					return
+				case <-c.inflight.closing:
+					return
+				}
+			}
+			timer := time.NewTimer(interval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-c.inflight.closing:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+	return events
+}
+
+// Prewarm opens up to n connections to the privacy manager ahead of real
+// traffic, so that the first calls after startup don't pay for connecting. It
+// sends n upchecks at once and holds each response until all have arrived, so
+// that every upcheck gets its own connection, which is then left idle in the
+// pool. Only as many connections as WithMaxIdleConns allows per host are kept,
+// and n is capped by WithMaxInFlight. The first error encountered is returned.
+// Prewarm does nothing if n isn't positive.
+func (c *Client) Prewarm(ctx context.Context, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	if max := c.cfg.maxInFlight; max > 0 && n > max {
+		n = max
+	}
+	var (
+		wg        sync.WaitGroup
+		responses = make([]*http.Response, n)
+		errs      = make([]error, n)
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req, err := http.NewRequestWithContext(ctx, "GET", c.requestURL("upcheck"), nil)
+			if err == nil {
+				responses[i], err = c.do(opUpcheck, req)
+			}
+			errs[i] = err
+		}(i)
+	}
+	wg.Wait()
+
+	for _, res := range responses {
+		if res != nil {
+			drainAndClose(res)
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// healthReport is the body served by the handler of HealthHandler.
+type healthReport struct {
+	Up      bool   `json:"up"`
+	Status  int    `json:"status,omitempty"` // of the upcheck, if it was answered
+	Latency string `json:"latency,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// HealthHandler returns an http.Handler that runs the privacy manager's
+// upcheck on every request, for health aggregators such as a /healthz
+// endpoint. It answers 200 OK if the privacy manager is up and 503 Service
+// Unavailable otherwise, with a JSON body such as
+//
+//	{"up":true,"status":200,"latency":"1.2ms"}
+func (c *Client) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var report healthReport
+		health, err := c.HealthCheck(r.Context())
+		if err != nil {
+			report.Error = err.Error()
+		} else {
+			report.Up = health.Up
+			report.Status = health.StatusCode
+			report.Latency = health.Latency.String()
+			if !health.Up {
+				report.Error = fmt.Sprintf("upcheck returned status %d", health.StatusCode)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if !report.Up {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(&report)
+	})
+}
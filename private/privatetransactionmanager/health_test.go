@@ -0,0 +1,372 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealthCheck(t *testing.T) {
+	var down int32
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/upcheck" {
+			http.NotFound(w, r)
+			return
+		}
+		if atomic.LoadInt32(&down) != 0 {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("I'm up!"))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	health, err := c.HealthCheck(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !health.Up || health.StatusCode != http.StatusOK || string(health.Body) != "I'm up!" || health.Latency <= 0 {
+		t.Fatalf("got health %+v for running node", health)
+	}
+	if err := RunNode(socketPath); err != nil {
+		t.Fatalf("RunNode failed for running node: %v", err)
+	}
+
+	atomic.StoreInt32(&down, 1)
+	health, err = c.HealthCheck(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.Up || health.StatusCode != http.StatusServiceUnavailable || string(health.Body) != "shutting down" {
+		t.Fatalf("got health %+v for node shutting down", health)
+	}
+	if err := RunNode(socketPath); err == nil {
+		t.Fatal("RunNode succeeded for node shutting down")
+	}
+}
+
+func TestUpcheckConnections(t *testing.T) {
+	var conns connCounter
+	var open int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("I'm up!"))
+	}))
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		conns.track(conn, state)
+		switch state {
+		case http.StateNew:
+			atomic.AddInt32(&open, 1)
+		case http.StateClosed, http.StateHijacked:
+			atomic.AddInt32(&open, -1)
+		}
+	}
+	socketPath, shutdown := startTestServer(t, srv)
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		if _, err := c.HealthCheck(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := conns.count(); n != 1 {
+		t.Fatalf("50 upchecks used %d connections, want 1", n)
+	}
+	c.Close()
+
+	for i := 0; i < 50; i++ {
+		if err := RunNode(socketPath); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&open) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d connections left open by RunNode", atomic.LoadInt32(&open))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRunNodeContext(t *testing.T) {
+	release := make(chan struct{})
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer shutdown()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := RunNodeContext(ctx, socketPath, WithRequestTimeout(time.Minute)); err == nil {
+		t.Fatal("RunNodeContext succeeded for hanging node")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("upcheck took %v", elapsed)
+	}
+
+	start = time.Now()
+	if err := RunNodeContext(context.Background(), socketPath, WithRequestTimeout(100*time.Millisecond)); err == nil {
+		t.Fatal("RunNodeContext succeeded for hanging node")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("upcheck took %v", elapsed)
+	}
+}
+
+func TestHealthCheckUnreachable(t *testing.T) {
+	c, err := NewClient("/nonexistent/tm.ipc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.HealthCheck(context.Background()); err == nil {
+		t.Fatal("expected error for unreachable node")
+	}
+}
+
+func TestWaitUntilUp(t *testing.T) {
+	var calls int32
+	socketPath, shutdown := newTestServer(t, flakyHandler(3, &calls))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WaitUntilUp(context.Background(), 10*time.Millisecond, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 4 {
+		t.Fatalf("got %d upchecks, want 4", calls)
+	}
+}
+
+func TestWaitUntilUpTimeout(t *testing.T) {
+	c, err := NewClient("/nonexistent/tm.ipc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	err = c.WaitUntilUp(context.Background(), 10*time.Millisecond, 200*time.Millisecond)
+	if err == nil || err == context.DeadlineExceeded {
+		t.Fatalf("got error %v, want the upcheck's error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("waiting took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if err := c.WaitUntilUp(ctx, 10*time.Millisecond, 0); err != context.Canceled {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestHealthMonitor(t *testing.T) {
+	var down int32
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) != 0 {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("I'm up!"))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := c.StartHealthMonitor(ctx, 10*time.Millisecond)
+
+	next := func() HealthEvent {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatal("monitor stopped early")
+			}
+			return ev
+		case <-time.After(5 * time.Second):
+			t.Fatal("no health event")
+		}
+		panic("unreachable")
+	}
+	if ev := next(); !ev.Up || ev.Err != nil {
+		t.Fatalf("got initial event %+v, want up", ev)
+	}
+	atomic.StoreInt32(&down, 1)
+	if ev := next(); ev.Up || ev.Err == nil || ev.Health.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("got event %+v, want down", ev)
+	}
+	atomic.StoreInt32(&down, 0)
+	if ev := next(); !ev.Up {
+		t.Fatalf("got event %+v, want up again", ev)
+	}
+
+	cancel()
+	for range events {
+		// Drain an event the monitor may have sent before stopping.
+	}
+}
+
+func TestHealthMonitorClose(t *testing.T) {
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("I'm up!"))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := c.StartHealthMonitor(context.Background(), 10*time.Millisecond)
+	if ev := <-events; !ev.Up {
+		t.Fatalf("got initial event %+v, want up", ev)
+	}
+	c.Close()
+	select {
+	case ev, ok := <-events:
+		if ok {
+			t.Fatalf("got event %+v after Close, want the monitor stopped", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("monitor still running after Close")
+	}
+}
+
+func TestHealthMonitorInterval(t *testing.T) {
+	var calls int32
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte("I'm up!"))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, interval := range []time.Duration{0, -time.Second} {
+		atomic.StoreInt32(&calls, 0)
+		ctx, cancel := context.WithCancel(context.Background())
+		events := c.StartHealthMonitor(ctx, interval)
+		<-events
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+		for range events {
+			// Drain an event the monitor may have sent before stopping.
+		}
+		// At least 10ms apart, a busy loop would upcheck far more often.
+		if n := atomic.LoadInt32(&calls); n > 20 {
+			t.Errorf("interval %v: got %d upchecks in 100ms, want at most 20", interval, n)
+		}
+	}
+}
+
+func TestPrewarm(t *testing.T) {
+	var conns connCounter
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("I'm up!"))
+	}))
+	srv.Config.ConnState = conns.track
+	socketPath, shutdown := startTestServer(t, srv)
+	defer shutdown()
+
+	c, err := NewClient(socketPath, WithMaxIdleConns(0, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Prewarm(context.Background(), 4); err != nil {
+		t.Fatal(err)
+	}
+	if n := conns.count(); n != 4 {
+		t.Fatalf("prewarming opened %d connections, want 4", n)
+	}
+
+	// Calls made at once now find their connections ready.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.HealthCheck(context.Background())
+		}()
+	}
+	wg.Wait()
+	if n := conns.count(); n != 4 {
+		t.Fatalf("%d connections after prewarming and 4 calls, want 4", n)
+	}
+
+	if err := c.Prewarm(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{0, -1} {
+		if err := c.Prewarm(context.Background(), n); err != nil {
+			t.Fatalf("prewarming %d connections: %v", n, err)
+		}
+	}
+	c.Close()
+	if err := c.Prewarm(context.Background(), 1); err != ErrClientClosed {
+		t.Fatalf("got error %v after Close, want %v", err, ErrClientClosed)
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	var down int32
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) != 0 {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("I'm up!"))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable, err := NewClient("/nonexistent/tm.ipc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(c *Client, wantCode int, wantUp bool) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		c.HealthHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+		if rec.Code != wantCode {
+			t.Fatalf("got status %d, want %d", rec.Code, wantCode)
+		}
+		var report healthReport
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		if report.Up != wantUp || report.Up != (report.Error == "") {
+			t.Fatalf("got report %+v, want up %v", report, wantUp)
+		}
+	}
+	check(c, http.StatusOK, true)
+	atomic.StoreInt32(&down, 1)
+	check(c, http.StatusServiceUnavailable, false)
+	check(unreachable, http.StatusServiceUnavailable, false)
+}
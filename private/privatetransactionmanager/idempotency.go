@@ -0,0 +1,83 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+)
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey returns a copy of ctx that marks the sends made with it
+// as attempts of the same send identified by key, such as a caller's own
+// retries, so that a client with WithSendDeduplication distributes the payload
+// only once. Keys are compared as they are; the caller must make sure that
+// different payloads get different keys.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// sendDedup suppresses repeated sends carrying the same idempotency key. Its
+// methods pass sends straight through on a nil receiver.
+//
+// Neither Constellation nor Tessera deduplicates sends, so this happens in
+// the client alone: a send whose acknowledgement was lost on the way still
+// failed from the client's point of view and is not remembered.
+type sendDedup struct {
+	mu      sync.Mutex
+	sent    *gocache.Cache // SendResult of the successful sends by key
+	pending map[string]*pendingSend
+}
+
+// pendingSend is a send in progress that later sends with the same key wait
+// for.
+type pendingSend struct {
+	done   chan struct{}
+	result SendResult
+}
+
+func newSendDedup(ttl time.Duration) *sendDedup {
+	return &sendDedup{
+		sent:    gocache.New(ttl, ttl),
+		pending: make(map[string]*pendingSend),
+	}
+}
+
+// send calls send unless a send with the idempotency key in ctx succeeded
+// before or is in progress, in which case its result is returned instead.
+func (d *sendDedup) send(ctx context.Context, send func() SendResult) SendResult {
+	key, _ := ctx.Value(idempotencyKey{}).(string)
+	if d == nil || key == "" {
+		return send()
+	}
+	d.mu.Lock()
+	if result, ok := d.sent.Get(key); ok {
+		d.mu.Unlock()
+		return result.(SendResult)
+	}
+	if p := d.pending[key]; p != nil {
+		d.mu.Unlock()
+		select {
+		case <-p.done:
+			return p.result
+		case <-ctx.Done():
+			return SendResult{Err: ctx.Err()}
+		}
+	}
+	p := &pendingSend{done: make(chan struct{})}
+	d.pending[key] = p
+	d.mu.Unlock()
+
+	p.result = send()
+
+	d.mu.Lock()
+	delete(d.pending, key)
+	if p.result.Err == nil {
+		d.sent.Set(key, p.result, gocache.DefaultExpiration)
+	}
+	d.mu.Unlock()
+	close(p.done)
+	return p.result
+}
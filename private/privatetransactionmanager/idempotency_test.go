@@ -0,0 +1,76 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSendDeduplication(t *testing.T) {
+	var sends, failures int32
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&sends, 1)
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte(testPayloadHash.ToBase64()))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath, WithSendDeduplication(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(ctx context.Context) error {
+		_, err := c.SendPayload(ctx, []byte("payload"), "", []string{testRecipient})
+		return err
+	}
+	check := func(want int32) {
+		t.Helper()
+		if n := atomic.SwapInt32(&sends, 0); n != want {
+			t.Fatalf("privacy manager got %d sends, want %d", n, want)
+		}
+	}
+
+	// Concurrent and later sends with the same key are distributed once.
+	ctx := WithIdempotencyKey(context.Background(), "tx-1")
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := send(ctx); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := send(ctx); err != nil {
+		t.Fatal(err)
+	}
+	check(1)
+
+	// Other keys and sends without a key are not affected.
+	if err := send(WithIdempotencyKey(context.Background(), "tx-2")); err != nil {
+		t.Fatal(err)
+	}
+	send(context.Background())
+	send(context.Background())
+	check(3)
+
+	// A failed send is attempted again.
+	atomic.StoreInt32(&failures, 1)
+	ctx = WithIdempotencyKey(context.Background(), "tx-3")
+	if err := send(ctx); err == nil {
+		t.Fatal("expected first send to fail")
+	}
+	if err := send(ctx); err != nil {
+		t.Fatal(err)
+	}
+	check(2)
+}
@@ -0,0 +1,165 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// inflight counts the requests a Client has in progress and, if a limit is
+// configured, bounds them. Closing it cancels the requests in progress.
+type inflight struct {
+	n       int32
+	sem     chan struct{}   // nil without a limit
+	wait    bool            // whether to wait for a slot or fail right away
+	counter metrics.Counter // nil without metrics
+
+	mu        sync.Mutex
+	closing   chan struct{} // closed once no new requests are accepted
+	cancelled bool          // whether the requests in progress were cancelled
+	cancels   map[uint64]context.CancelFunc
+	nextID    uint64
+}
+
+func newInflight(cfg *clientConfig) *inflight {
+	l := &inflight{
+		wait:    cfg.waitForSlot,
+		closing: make(chan struct{}),
+		cancels: make(map[uint64]context.CancelFunc),
+	}
+	if cfg.maxInFlight > 0 {
+		l.sem = make(chan struct{}, cfg.maxInFlight)
+	}
+	if cfg.metrics != nil {
+		l.counter = metrics.GetOrRegisterCounter(metricsPrefix+"inflight", cfg.metrics)
+	}
+	return l
+}
+
+// acquire takes a slot for a request, waiting for one until ctx is done if
+// the limit is reached, or failing with ErrConcurrencyLimit if waiting is
+// disabled. The request must be sent with the returned context, which is
+// cancelled when the client is closed. The returned function releases the
+// slot and the context; it may be called more than once.
+func (l *inflight) acquire(ctx context.Context) (context.Context, func(), error) {
+	if l.closed() {
+		return nil, nil, ErrClientClosed
+	}
+	if l.sem != nil {
+		select {
+		case l.sem <- struct{}{}:
+		default:
+			if !l.wait {
+				return nil, nil, ErrConcurrencyLimit
+			}
+			select {
+			case l.sem <- struct{}{}:
+			case <-ctx.Done():
+				return nil, nil, ctx.Err()
+			case <-l.closing:
+				return nil, nil, ErrClientClosed
+			}
+		}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	l.mu.Lock()
+	if l.closed() {
+		l.mu.Unlock()
+		cancel()
+		if l.sem != nil {
+			<-l.sem
+		}
+		return nil, nil, ErrClientClosed
+	}
+	id := l.nextID
+	l.nextID++
+	l.cancels[id] = cancel
+	l.mu.Unlock()
+	atomic.AddInt32(&l.n, 1)
+	l.update(1)
+
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			l.mu.Lock()
+			delete(l.cancels, id)
+			l.mu.Unlock()
+			cancel()
+			atomic.AddInt32(&l.n, -1)
+			l.update(-1)
+			if l.sem != nil {
+				<-l.sem
+			}
+		})
+	}, nil
+}
+
+// update adds delta to the requests in progress of all clients sharing the
+// metrics registry.
+func (l *inflight) update(delta int64) {
+	if l.counter != nil {
+		l.counter.Inc(delta)
+	}
+}
+
+// count returns the number of requests in progress.
+func (l *inflight) count() int {
+	return int(atomic.LoadInt32(&l.n))
+}
+
+// stop makes new requests fail with ErrClientClosed, leaving those in
+// progress alone.
+func (l *inflight) stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.closed() {
+		close(l.closing)
+	}
+}
+
+// close stops new requests and cancels those in progress.
+func (l *inflight) close() {
+	l.stop()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cancelled = true
+	for _, cancel := range l.cancels {
+		cancel()
+	}
+}
+
+// wasCancelled reports whether the requests in progress have been cancelled
+// by close.
+func (l *inflight) wasCancelled() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cancelled
+}
+
+// drain waits until no requests are in progress or timeout has elapsed, and
+// returns the number still in progress.
+func (l *inflight) drain(timeout time.Duration) int {
+	deadline := time.Now().Add(timeout)
+	for {
+		n := l.count()
+		if n == 0 || !time.Now().Before(deadline) {
+			return n
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// closed reports whether new requests are no longer accepted.
+func (l *inflight) closed() bool {
+	select {
+	case <-l.closing:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,206 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// API selects the privacy manager endpoints used by calls available on both,
+// see WithAPI.
+type API int
+
+const (
+	RawAPI  API = iota // the octet-stream endpoints such as /sendraw
+	JSONAPI            // Tessera's JSON endpoints such as /send
+)
+
+type sendReq struct {
+	Payload                      string      `json:"payload"`
+	From                         string      `json:"from,omitempty"`
+	To                           []string    `json:"to"`
+	PrivacyFlag                  PrivacyFlag `json:"privacyFlag,omitempty"`
+	MandatoryRecipients          []string    `json:"mandatoryRecipients,omitempty"`
+	AffectedContractTransactions []string    `json:"affectedContractTransactions,omitempty"`
+	ExecHash                     string      `json:"execHash,omitempty"`
+	PrivacyGroupID               string      `json:"privacyGroupId,omitempty"`
+}
+
+type sendResp struct {
+	Key            string      `json:"key"`
+	ManagedParties []PublicKey `json:"managedParties"`
+}
+
+type receiveReq struct {
+	Key string `json:"key"`
+	To  string `json:"to,omitempty"`
+}
+
+// ReceivedPayload is a payload returned by Tessera's JSON /receive API,
+// together with the details Tessera keeps about it.
+type ReceivedPayload struct {
+	Payload                      []byte      `json:"payload"`
+	SenderKey                    string      `json:"senderKey"`      // base64 key of the sender
+	PrivacyGroupID               string      `json:"privacyGroupId"` // base64 id of the privacy group
+	PrivacyFlag                  PrivacyFlag `json:"privacyFlag"`
+	AffectedContractTransactions []string    `json:"affectedContractTransactions"` // base64 payload hashes
+	ExecHash                     string      `json:"execHash"`
+
+	// ManagedParties are the base64 keys managed by the node that are parties
+	// to the payload. It is nil if the privacy manager doesn't report them,
+	// and empty if it does but none of the node's keys is a party.
+	ManagedParties []string `json:"managedParties"`
+}
+
+// Recipient tells from ManagedParties whether the node is a party to p.
+func (p *ReceivedPayload) Recipient() RecipientStatus {
+	switch {
+	case p.ManagedParties == nil:
+		return RecipientUnknown
+	case len(p.ManagedParties) > 0:
+		return RecipientLocal
+	default:
+		return RecipientRelay
+	}
+}
+
+// SendJSON is like SendPayload, using Tessera's JSON /send API instead of
+// /sendraw, for Tessera nodes that only expose the JSON API.
+func (c *Client) SendJSON(ctx context.Context, pl []byte, b64From string, b64To []string) (common.EncryptedPayloadHash, error) {
+	result := c.sendJSON(ctx, pl, b64From, b64To, &SendOptions{})
+	return result.Hash, result.Err
+}
+
+func (c *Client) sendJSON(ctx context.Context, pl []byte, b64From string, b64To []string, opts *SendOptions) SendResult {
+	b64From = c.sender(b64From)
+	if err := validateKeys(b64From, b64To); err != nil {
+		return SendResult{Err: err}
+	}
+	if err := opts.validate(b64To); err != nil {
+		return SendResult{Err: err}
+	}
+	if err := c.checkPayloadSize(int64(len(pl))); err != nil {
+		return SendResult{Err: err}
+	}
+	sendReq := &sendReq{
+		Payload:             base64.StdEncoding.EncodeToString(pl),
+		From:                b64From,
+		To:                  b64To,
+		PrivacyFlag:         opts.PrivacyFlag,
+		MandatoryRecipients: opts.MandatoryRecipients,
+		ExecHash:            opts.ExecHash,
+		PrivacyGroupID:      opts.PrivacyGroupID,
+	}
+	if sendReq.To == nil {
+		sendReq.To = []string{}
+	}
+	for _, hash := range opts.AffectedContractTransactions {
+		sendReq.AffectedContractTransactions = append(sendReq.AffectedContractTransactions, hash.ToBase64())
+	}
+	var sendResp sendResp
+	if err := c.doJson(ctx, opSend, "send", sendReq, &sendResp); err != nil {
+		return SendResult{Err: err}
+	}
+	hash, err := decodePayloadHash(strings.NewReader(sendResp.Key))
+	if err != nil {
+		return SendResult{Err: err}
+	}
+	return SendResult{Hash: hash, ManagedParties: sendResp.ManagedParties}
+}
+
+// ReceiveJSON is like ReceivePayloadWithMeta, using Tessera's JSON /receive
+// API. b64To selects the recipient key to decrypt the payload with on nodes
+// holding several keys; if empty, Tessera uses its default key. It returns
+// ErrPayloadNotFound if the privacy manager doesn't know the key.
+func (c *Client) ReceiveJSON(ctx context.Context, key []byte, b64To string) (*ReceivedPayload, error) {
+	receiveReq := &receiveReq{
+		Key: base64.StdEncoding.EncodeToString(key),
+		To:  b64To,
+	}
+	var received ReceivedPayload
+	err := c.doJson(ctx, opReceive, "receive", receiveReq, &received)
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound {
+		return nil, ErrPayloadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.cfg.verifyPayloads && len(key) > 0 && len(received.Payload) == 0 {
+		return nil, ErrEmptyPayload
+	}
+	return &received, nil
+}
+
+// meta returns the details of a payload received through the JSON API.
+func (p *ReceivedPayload) meta() (*ReceiveMeta, error) {
+	meta := &ReceiveMeta{PrivacyGroupID: p.PrivacyGroupID, PrivacyFlag: p.PrivacyFlag, Recipient: p.Recipient()}
+	if p.SenderKey != "" {
+		key, err := ParsePublicKey(p.SenderKey)
+		if err != nil {
+			return nil, fmt.Errorf("sender of received payload: %v", err)
+		}
+		meta.Sender = key
+	}
+	return meta, nil
+}
+
+// Transaction holds everything the privacy manager knows about a stored
+// transaction payload.
+type Transaction struct {
+	ReceivedPayload
+	Sender     PublicKey   // parsed SenderKey, if reported
+	Recipients []PublicKey // the parties to the payload, as by GetParticipants
+}
+
+// GetTransaction returns the payload stored under txHash together with its
+// details, decrypted for b64To if set, from Tessera's /transaction/{hash} API.
+// Tessera doesn't report the recipients there, so they are fetched with
+// GetParticipants, which is answered from the cache if WithTxInfoCache is
+// enabled. It returns ErrPayloadNotFound if the privacy manager doesn't know
+// the hash.
+func (c *Client) GetTransaction(ctx context.Context, txHash common.EncryptedPayloadHash, b64To string) (*Transaction, error) {
+	path := transactionPath(txHash, "")
+	if b64To != "" {
+		if err := validateKeys("", []string{b64To}); err != nil {
+			return nil, err
+		}
+		path += "?" + url.Values{"to": {b64To}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", c.requestURL(path), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.do(opTransaction, req, "hash", txHash.TerminalString())
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound {
+		return nil, ErrPayloadNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer drainAndClose(res)
+
+	tx := new(Transaction)
+	if err := json.NewDecoder(res.Body).Decode(&tx.ReceivedPayload); err != nil {
+		return nil, err
+	}
+	meta, err := tx.meta()
+	if err != nil {
+		return nil, err
+	}
+	tx.Sender = meta.Sender
+	if tx.Recipients, err = c.GetParticipants(ctx, txHash); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
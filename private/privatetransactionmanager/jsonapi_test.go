@@ -0,0 +1,290 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestSendJSON(t *testing.T) {
+	var got sendReq
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/send" || r.Header.Get("Content-Type") != "application/json" {
+			http.NotFound(w, r)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(&sendResp{Key: testPayloadHash.ToBase64()})
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := testKey(9)
+	hash, err := c.SendJSON(context.Background(), []byte("payload"), from, []string{testRecipient})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != testPayloadHash {
+		t.Fatalf("got hash %x, want %x", hash, testPayloadHash)
+	}
+	want := sendReq{Payload: "cGF5bG9hZA==", From: from, To: []string{testRecipient}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got request %+v, want %+v", got, want)
+	}
+	if _, err := c.SendJSON(context.Background(), []byte("payload"), "", []string{"not base64!"}); err == nil {
+		t.Fatal("expected error for invalid recipient")
+	}
+}
+
+func TestReceiveJSON(t *testing.T) {
+	var got receiveReq
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/receive" {
+			http.NotFound(w, r)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if got.Key != testPayloadHash.ToBase64() {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"payload":"cGF5bG9hZA==","senderKey":"sender","privacyGroupId":"group","privacyFlag":1}`))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received, err := c.ReceiveJSON(context.Background(), testPayloadHash.Bytes(), testRecipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ReceivedPayload{
+		Payload:        []byte("payload"),
+		SenderKey:      "sender",
+		PrivacyGroupID: "group",
+		PrivacyFlag:    PrivacyFlagPartyProtection,
+	}
+	if !reflect.DeepEqual(received, want) {
+		t.Fatalf("got %+v, want %+v", received, want)
+	}
+	if got.To != testRecipient {
+		t.Fatalf("got recipient %q, want %q", got.To, testRecipient)
+	}
+	if _, err := c.ReceiveJSON(context.Background(), []byte("unknown"), ""); err != ErrPayloadNotFound {
+		t.Fatalf("got error %v, want %v", err, ErrPayloadNotFound)
+	}
+}
+
+func TestReceiveRecipientStatus(t *testing.T) {
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/receiveraw" {
+			w.Write([]byte("payload"))
+			return
+		}
+		var got receiveReq
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		key, _ := base64.StdEncoding.DecodeString(got.Key)
+		switch string(key) {
+		case "local":
+			w.Write([]byte(`{"payload":"cGF5bG9hZA==","managedParties":["` + testRecipient + `"]}`))
+		case "relay":
+			w.Write([]byte(`{"payload":"b3BhcXVl","managedParties":[]}`))
+		default:
+			w.Write([]byte(`{"payload":"cGF5bG9hZA=="}`))
+		}
+	}))
+	defer shutdown()
+
+	for _, tt := range []struct {
+		api  API
+		key  string
+		want RecipientStatus
+	}{
+		{JSONAPI, "local", RecipientLocal},
+		{JSONAPI, "relay", RecipientRelay},
+		{JSONAPI, "unreported", RecipientUnknown},
+		{RawAPI, "local", RecipientUnknown},
+	} {
+		c, err := NewClient(socketPath, WithAPI(tt.api))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, meta, err := c.ReceivePayloadWithMeta(context.Background(), []byte(tt.key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta.Recipient != tt.want {
+			t.Fatalf("api %d, key %s: got recipient status %d, want %d", tt.api, tt.key, meta.Recipient, tt.want)
+		}
+	}
+}
+
+func TestWithAPI(t *testing.T) {
+	sender := testKey(9)
+	var paths []string
+	var got sendReq
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/sendraw":
+			w.Write([]byte(testPayloadHash.ToBase64()))
+		case "/send":
+			json.NewDecoder(r.Body).Decode(&got)
+			json.NewEncoder(w).Encode(&sendResp{Key: testPayloadHash.ToBase64()})
+		case "/receiveraw":
+			w.Write([]byte("raw"))
+		case "/receive":
+			w.Write([]byte(`{"payload":"anNvbg==","senderKey":"` + sender + `","privacyFlag":1}`))
+		}
+	}))
+	defer shutdown()
+
+	for _, tt := range []struct {
+		api     API
+		paths   []string
+		payload string
+	}{
+		{RawAPI, []string{"/sendraw", "/receiveraw", "/receiveraw"}, "raw"},
+		{JSONAPI, []string{"/send", "/receive", "/receive"}, "json"},
+	} {
+		paths = nil
+		c, err := NewClient(socketPath, WithAPI(tt.api))
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := &SendOptions{PrivacyFlag: PrivacyFlagPartyProtection}
+		if _, err := c.SendPayloadWithOptions(context.Background(), []byte("payload"), "", []string{testRecipient}, opts); err != nil {
+			t.Fatal(err)
+		}
+		pl, err := c.ReceivePayload(context.Background(), testPayloadHash.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(pl) != tt.payload {
+			t.Fatalf("got payload %q, want %q", pl, tt.payload)
+		}
+		if _, _, err := c.ReceivePayloadWithMeta(context.Background(), testPayloadHash.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(paths, tt.paths) {
+			t.Fatalf("api %d: got requests %v, want %v", tt.api, paths, tt.paths)
+		}
+	}
+	if got.PrivacyFlag != PrivacyFlagPartyProtection {
+		t.Fatalf("got privacy flag %d in JSON send, want %d", got.PrivacyFlag, PrivacyFlagPartyProtection)
+	}
+
+	c, err := NewClient(socketPath, WithAPI(JSONAPI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, meta, err := c.ReceivePayloadWithMeta(context.Background(), testPayloadHash.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Sender.String() != sender || meta.PrivacyFlag != PrivacyFlagPartyProtection {
+		t.Fatalf("got meta %+v", meta)
+	}
+}
+
+func TestSendPayloadResult(t *testing.T) {
+	parties := []PublicKey{PublicKey(testKey(7)), PublicKey(testKey(8))}
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sendraw":
+			w.Write([]byte(testPayloadHash.ToBase64()))
+		case "/send":
+			json.NewEncoder(w).Encode(&sendResp{Key: testPayloadHash.ToBase64(), ManagedParties: parties})
+		}
+	}))
+	defer shutdown()
+
+	for _, tt := range []struct {
+		api     API
+		parties []PublicKey
+	}{
+		{RawAPI, nil},
+		{JSONAPI, parties},
+	} {
+		c, err := NewClient(socketPath, WithAPI(tt.api))
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := c.SendPayloadResult(context.Background(), []byte("payload"), "", []string{testRecipient})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := &SentPayload{Hash: testPayloadHash, ManagedParties: tt.parties}
+		if !reflect.DeepEqual(result, want) {
+			t.Fatalf("api %d: got result %+v, want %+v", tt.api, result, want)
+		}
+	}
+	c, err := NewClient("/nonexistent/tm.ipc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, err := c.SendPayloadResult(context.Background(), []byte("payload"), "", []string{testRecipient}); err == nil || result != nil {
+		t.Fatalf("got result %+v, error %v from unreachable node", result, err)
+	}
+}
+
+func TestGetTransaction(t *testing.T) {
+	sender, recipient := testKey(9), testKey(1)
+	var gotTo string
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		base := "/transaction/" + testPayloadHash.ToBase64()
+		switch r.URL.Path {
+		case base:
+			gotTo = r.URL.Query().Get("to")
+			w.Write([]byte(`{"payload":"cGF5bG9hZA==","senderKey":"` + sender + `","privacyGroupId":"group","privacyFlag":1}`))
+		case base + "/participants":
+			w.Write([]byte(sender + "," + recipient))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := c.GetTransaction(context.Background(), testPayloadHash, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotTo != recipient {
+		t.Fatalf("got recipient %q, want %q", gotTo, recipient)
+	}
+	if string(tx.Payload) != "payload" || tx.PrivacyGroupID != "group" || tx.PrivacyFlag != PrivacyFlagPartyProtection {
+		t.Fatalf("got transaction %+v", tx)
+	}
+	if tx.Sender.String() != sender {
+		t.Fatalf("got sender %s, want %s", tx.Sender, sender)
+	}
+	if len(tx.Recipients) != 2 || tx.Recipients[1].String() != recipient {
+		t.Fatalf("got recipients %v", tx.Recipients)
+	}
+	if _, err := c.GetTransaction(context.Background(), common.BytesToEncryptedPayloadHash([]byte("unknown")), ""); err != ErrPayloadNotFound {
+		t.Fatalf("got error %v, want %v", err, ErrPayloadNotFound)
+	}
+}
@@ -0,0 +1,147 @@
+package privatetransactionmanager
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// metricsPrefix is prepended to the names of all privacy manager metrics.
+const metricsPrefix = "ptm/"
+
+// latencyBuckets are the upper bounds of the latency histogram buckets, sized
+// for calls over a local socket.
+var latencyBuckets = []time.Duration{
+	250 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	25 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// sizeBuckets are the upper bounds and names of the payload size classes
+// request durations are broken down by.
+var sizeBuckets = []struct {
+	limit int64
+	name  string
+}{
+	{1 << 10, "1kb"},
+	{64 << 10, "64kb"},
+	{1 << 20, "1mb"},
+	{16 << 20, "16mb"},
+}
+
+// clientMetrics records request counts, latencies and traffic of a Client in
+// a metrics registry. Per-operation metrics are named ptm/<operation>/...,
+// with request counts additionally broken down by response status, and
+// latencies by bucket and payload size.
+type clientMetrics struct {
+	registry metrics.Registry
+	egress   metrics.Meter // bytes sent to the privacy manager
+	ingress  metrics.Meter // bytes received from the privacy manager
+}
+
+func newClientMetrics(registry metrics.Registry) *clientMetrics {
+	return &clientMetrics{
+		registry: registry,
+		egress:   metrics.GetOrRegisterMeter(metricsPrefix+"egress", registry),
+		ingress:  metrics.GetOrRegisterMeter(metricsPrefix+"ingress", registry),
+	}
+}
+
+// observe records a completed request with the given response status code,
+// which is zero if no response was received, and the response if it was
+// successful. It is a no-op on a nil receiver, so clients without metrics need
+// no special casing.
+func (m *clientMetrics) observe(op operation, req *http.Request, res *http.Response, code int, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	status := "error"
+	if code != 0 {
+		status = strconv.Itoa(code)
+	}
+	base := metricsPrefix + op.name + "/"
+	metrics.GetOrRegisterMeter(base+"requests", m.registry).Mark(1)
+	metrics.GetOrRegisterMeter(base+"status/"+status, m.registry).Mark(1)
+	metrics.GetOrRegisterTimer(base+"duration", m.registry).Update(elapsed)
+	metrics.GetOrRegisterCounter(base+"latency/"+latencyBucket(elapsed), m.registry).Inc(1)
+
+	// The payload travels in the request of a send and the response of a
+	// receive, take whichever is larger.
+	size := req.ContentLength
+	if res != nil && res.ContentLength > size {
+		size = res.ContentLength
+	}
+	if size >= 0 {
+		metrics.GetOrRegisterTimer(base+"size/"+sizeBucket(size)+"/duration", m.registry).Update(elapsed)
+	}
+}
+
+// latencyBucket names the latency histogram bucket of elapsed, e.g. "1ms" for
+// latencies between 250µs and 1ms, or "inf" beyond the largest bucket.
+func latencyBucket(elapsed time.Duration) string {
+	for _, limit := range latencyBuckets {
+		if elapsed <= limit {
+			return limit.String()
+		}
+	}
+	return "inf"
+}
+
+// sizeBucket names the size class of a payload of size bytes.
+func sizeBucket(size int64) string {
+	for _, bucket := range sizeBuckets {
+		if size <= bucket.limit {
+			return bucket.name
+		}
+	}
+	return "large"
+}
+
+// cacheLookup records a hit or miss of the named response cache as
+// ptm/cache/<name>/hits or ptm/cache/<name>/misses.
+func (m *clientMetrics) cacheLookup(name string, hit bool) {
+	if m == nil {
+		return
+	}
+	outcome := "misses"
+	if hit {
+		outcome = "hits"
+	}
+	metrics.GetOrRegisterMeter(metricsPrefix+"cache/"+name+"/"+outcome, m.registry).Mark(1)
+}
+
+// meterBody counts the bytes read from a response body as ingress.
+func (m *clientMetrics) meterBody(body io.ReadCloser) io.ReadCloser {
+	if m == nil {
+		return body
+	}
+	return &meteredBody{ReadCloser: body, meter: m.ingress}
+}
+
+// meterRequestBody counts the bytes read from a request body as egress, so
+// that streamed sends of unknown length are counted too.
+func (m *clientMetrics) meterRequestBody(body io.ReadCloser) io.ReadCloser {
+	if m == nil {
+		return body
+	}
+	return &meteredBody{ReadCloser: body, meter: m.egress}
+}
+
+type meteredBody struct {
+	io.ReadCloser
+	meter metrics.Meter
+}
+
+func (b *meteredBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.meter.Mark(int64(n))
+	return n, err
+}
@@ -0,0 +1,146 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	enabled := metrics.Enabled
+	metrics.Enabled = true
+	defer func() { metrics.Enabled = enabled }()
+
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sendraw" {
+			ioutil.ReadAll(r.Body)
+			w.Write([]byte(testPayloadHash.ToBase64()))
+			return
+		}
+		if r.Header.Get("c11n-key") == "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("payload"))
+	}))
+	defer shutdown()
+
+	registry := metrics.NewRegistry()
+	c, err := NewClient(socketPath, WithMetrics(registry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ReceivePayload(context.Background(), []byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.IsSender(context.Background(), [64]byte{}); err == nil {
+		t.Fatal("expected 404 from isSender")
+	}
+	// A streamed send has no content length, but its bytes count all the same.
+	if _, err := c.SendPayloadReader(context.Background(), strings.NewReader("streamed"), -1, "", []string{testRecipient}); err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[string]int64{
+		"ptm/receiveraw/requests":   1,
+		"ptm/receiveraw/status/200": 1,
+		"ptm/issender/status/404":   1,
+		"ptm/egress":                int64(len("streamed")),
+		"ptm/ingress":               int64(len("payload") + len(testPayloadHash.ToBase64())),
+	}
+	for name, want := range counts {
+		m, ok := registry.Get(name).(metrics.Meter)
+		if !ok {
+			t.Fatalf("meter %s not registered", name)
+		}
+		if have := m.Count(); have != want {
+			t.Errorf("meter %s: have %d, want %d", name, have, want)
+		}
+	}
+	if timer, ok := registry.Get("ptm/receiveraw/duration").(metrics.Timer); !ok || timer.Count() != 1 {
+		t.Error("receive duration not recorded")
+	}
+	if timer, ok := registry.Get("ptm/receiveraw/size/1kb/duration").(metrics.Timer); !ok || timer.Count() != 1 {
+		t.Error("receive duration not recorded by payload size")
+	}
+	var buckets int64
+	registry.Each(func(name string, metric interface{}) {
+		if counter, ok := metric.(metrics.Counter); ok && strings.HasPrefix(name, "ptm/receiveraw/latency/") {
+			buckets += counter.Count()
+		}
+	})
+	if buckets != 1 {
+		t.Errorf("got %d receive latency observations, want 1", buckets)
+	}
+}
+
+func TestMetricsBuckets(t *testing.T) {
+	latencies := map[time.Duration]string{
+		100 * time.Microsecond: "250µs",
+		time.Millisecond:       "1ms",
+		2 * time.Millisecond:   "5ms",
+		3 * time.Second:        "5s",
+		time.Minute:            "inf",
+	}
+	for elapsed, want := range latencies {
+		if bucket := latencyBucket(elapsed); bucket != want {
+			t.Errorf("latency %v: got bucket %s, want %s", elapsed, bucket, want)
+		}
+	}
+	sizes := map[int64]string{0: "1kb", 1024: "1kb", 1025: "64kb", 1 << 20: "1mb", 1 << 30: "large"}
+	for size, want := range sizes {
+		if bucket := sizeBucket(size); bucket != want {
+			t.Errorf("size %d: got bucket %s, want %s", size, bucket, want)
+		}
+	}
+}
+
+func TestMetricsInflight(t *testing.T) {
+	enabled := metrics.Enabled
+	metrics.Enabled = true
+	defer func() { metrics.Enabled = enabled }()
+
+	var (
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.Write([]byte("0.10.2"))
+	}))
+	defer shutdown()
+
+	// Clients sharing a registry add up their requests in progress.
+	registry := metrics.NewRegistry()
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		c, err := NewClient(socketPath, WithMetrics(registry))
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			_, err := c.GetVersion(context.Background())
+			errs <- err
+		}()
+		<-started
+	}
+	inflight := registry.Get("ptm/inflight").(metrics.Counter)
+	if n := inflight.Count(); n != 2 {
+		t.Errorf("got %d requests in flight, want 2", n)
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := inflight.Count(); n != 0 {
+		t.Errorf("got %d requests in flight after they completed, want 0", n)
+	}
+}
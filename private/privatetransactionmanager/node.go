@@ -2,23 +2,24 @@ package privatetransactionmanager
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
-	"strconv"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
-
-	"github.com/tv42/httpunix"
+	"golang.org/x/time/rate"
 )
 
 type storeRawReq struct {
@@ -30,122 +31,424 @@ type storeRawResp struct {
 	Key string `json:"key"`
 }
 
-func launchNode(cfgPath string) (*exec.Cmd, error) {
-	cmd := exec.Command("constellation-node", cfgPath)
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return nil, err
+type deleteReq struct {
+	Key string `json:"key"`
+}
+
+type resendReq struct {
+	Type      string `json:"type"`
+	PublicKey string `json:"publicKey"`
+	Key       string `json:"key,omitempty"`
+}
+
+// unixTransport dials the privacy manager socket for every connection, ignoring
+// the host in the request URL. Unlike a write/read deadline on a raw socket, the
+// standard transport closes the connection when the request context is done, so
+// cancelling a call tears down the in-flight request.
+func unixTransport(socketPath string, cfg *clientConfig) *http.Transport {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return waitForRestart(ctx, cfg.restartWait, func() (net.Conn, error) {
+				return dialSocket(ctx, socketPath, cfg.dialTimeout)
+			})
+		},
+		ResponseHeaderTimeout: cfg.responseHeaderTimeout,
+		MaxIdleConns:          cfg.maxIdleConns,
+		MaxIdleConnsPerHost:   cfg.maxIdleConnsPerHost,
+		IdleConnTimeout:       cfg.idleConnTimeout,
 	}
-	go io.Copy(os.Stderr, stderr)
-	if err := cmd.Start(); err != nil {
-		return nil, err
+}
+
+// unixClient returns a plain HTTP client for the privacy manager socket, for
+// requests made outside of a Client.
+func unixClient(socketPath string, cfg *clientConfig) *http.Client {
+	return &http.Client{
+		Transport: unixTransport(socketPath, cfg),
+		Timeout:   cfg.requestTimeout,
 	}
-	time.Sleep(100 * time.Millisecond)
-	return cmd, nil
 }
 
-func unixTransport(socketPath string) *httpunix.Transport {
-	t := &httpunix.Transport{
-		DialTimeout:           1 * time.Second,
-		RequestTimeout:        5 * time.Second,
-		ResponseHeaderTimeout: 5 * time.Second,
+// tcpTransport connects to a privacy manager exposed on a TCP port, such as a
+// Tessera node running on another host.
+func tcpTransport(cfg *clientConfig) *http.Transport {
+	dialer := &net.Dialer{Timeout: cfg.dialTimeout}
+	return &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return waitForRestart(ctx, cfg.restartWait, func() (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			})
+		},
+		TLSClientConfig:       cfg.tlsConfig,
+		ForceAttemptHTTP2:     cfg.http2,
+		ResponseHeaderTimeout: cfg.responseHeaderTimeout,
+		MaxIdleConns:          cfg.maxIdleConns,
+		MaxIdleConnsPerHost:   cfg.maxIdleConnsPerHost,
+		IdleConnTimeout:       cfg.idleConnTimeout,
 	}
-	t.RegisterLocation("c", socketPath)
-	return t
 }
 
-func unixClient(socketPath string) *http.Client {
-	return &http.Client{
-		Transport: unixTransport(socketPath),
+// dialSocket connects to the privacy manager at socketPath, which is either a
+// unix socket or, on Windows, a named pipe.
+func dialSocket(ctx context.Context, socketPath string, timeout time.Duration) (net.Conn, error) {
+	if isNamedPipe(socketPath) {
+		return dialPipe(ctx, socketPath, timeout)
 	}
+	dialer := &net.Dialer{Timeout: timeout}
+	return dialer.DialContext(ctx, "unix", socketPath)
 }
 
+// restartPollInterval is the delay between two dials to a privacy manager
+// refusing connections while waiting for it to restart.
+const restartPollInterval = 50 * time.Millisecond
+
+// waitForRestart calls dial until it succeeds or fails other than with a
+// refused connection or a missing socket, which is how a restarting privacy
+// manager fails, for up to wait. A wait of zero calls dial once.
+func waitForRestart(ctx context.Context, wait time.Duration, dial func() (net.Conn, error)) (net.Conn, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		conn, err := dial()
+		if err == nil || !isRefused(err) || !time.Now().Add(restartPollInterval).Before(deadline) {
+			return conn, err
+		}
+		timer := time.NewTimer(restartPollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// isNamedPipe reports whether socketPath names a Windows named pipe, such as
+// \\.\pipe\tessera.
+func isNamedPipe(socketPath string) bool {
+	return strings.HasPrefix(socketPath, `\\.\pipe\`)
+}
+
+// isAbstractSocket reports whether socketPath names a socket in the Linux
+// abstract namespace, which by convention is written with a leading "@" in
+// place of the NUL byte. The net package translates the "@" when dialing.
+func isAbstractSocket(socketPath string) bool {
+	return runtime.GOOS == "linux" && strings.HasPrefix(socketPath, "@")
+}
+
+// unixBaseURL is the base of request URLs sent over a unix socket. The host is
+// never resolved since unixTransport always dials the configured socket.
+const unixBaseURL = "http://c/"
+
+// RunNode checks that the privacy manager listening on socketPath is up.
 func RunNode(socketPath string) error {
-	c := unixClient(socketPath)
-	res, err := c.Get("http+unix://c/upcheck")
+	return RunNodeContext(context.Background(), socketPath)
+}
+
+// RunNodeContext is like RunNode, but gives up when ctx is done. The upcheck
+// is also bounded by the client's request timeout, which can be changed with
+// WithRequestTimeout among opts.
+func RunNodeContext(ctx context.Context, socketPath string, opts ...Option) error {
+	c, err := NewClient(socketPath, opts...)
 	if err != nil {
 		return err
 	}
-	if res.StatusCode == 200 {
-		return nil
+	// The client is discarded after the upcheck, don't leave its connection
+	// open until the privacy manager times it out.
+	defer c.Close()
+
+	health, err := c.HealthCheck(ctx)
+	if err != nil {
+		return err
+	}
+	if !health.Up {
+		return errors.New("private transaction manager did not respond to upcheck request")
 	}
-	return errors.New("private transaction manager did not respond to upcheck request")
+	return nil
+}
+
+// Node is the privacy manager API used by PrivateTransactionManager. *Client
+// implements it on top of a running Constellation or Tessera node; tests can
+// provide their own implementation instead.
+type Node interface {
+	SendPayload(ctx context.Context, pl []byte, b64From string, b64To []string) (common.EncryptedPayloadHash, error)
+	StorePayload(ctx context.Context, pl []byte, b64From string) ([]byte, error)
+	SendSignedPayload(ctx context.Context, signedPayload []byte, b64To []string) ([]byte, error)
+	ReceivePayload(ctx context.Context, key []byte) ([]byte, error)
+	IsSender(ctx context.Context, txHash common.EncryptedPayloadHash) (bool, error)
+	GetParticipants(ctx context.Context, txHash common.EncryptedPayloadHash) ([]PublicKey, error)
 }
 
+var _ Node = (*Client)(nil)
+
 type Client struct {
+	connMu     sync.RWMutex // guards httpClient, transport and sockets, see SetSocketPath
 	httpClient *http.Client
+	transport  http.RoundTripper // the client's own transport, before WithRoundTripper
+	sockets    []string          // unix sockets of the privacy managers, if any
+	baseURL    string
+	cfg        *clientConfig
+	metrics    *clientMetrics
+	payloads   *payloadCache
+	txInfo     *txInfoCache
+	limiter    *rate.Limiter
+	inflight   *inflight
+	expvars    *expvarCounters
+	dedup      *sendDedup
+
+	backendMu sync.Mutex
+	backend   *BackendInfo // cached result of DetectBackend
 }
 
-func (c *Client) doJson(path string, apiReq interface{}) (*http.Response, error) {
-	buf := new(bytes.Buffer)
-	err := json.NewEncoder(buf).Encode(apiReq)
-	if err != nil {
-		return nil, err
+// requestURL returns the absolute URL of an API path on the privacy manager.
+func (c *Client) requestURL(path string) string {
+	return c.baseURL + path
+}
+
+// sender returns b64From, or the default sender if it is empty.
+func (c *Client) sender(b64From string) string {
+	if b64From == "" {
+		return c.cfg.defaultSender
 	}
-	req, err := http.NewRequest("POST", "http+unix://c/"+path, buf)
+	return b64From
+}
+
+// doJson posts apiReq as JSON to path and decodes the JSON response into
+// apiResp, unless it is nil. The response body is always drained and closed.
+func (c *Client) doJson(ctx context.Context, op operation, path string, apiReq, apiResp interface{}) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if err := json.NewEncoder(buf).Encode(apiReq); err != nil {
+		return err
+	}
+	// The transport may still be writing the body after the response has
+	// arrived, so it gets its own copy rather than the pooled buffer.
+	body := append(make([]byte, 0, buf.Len()), buf.Bytes()...)
+	req, err := http.NewRequestWithContext(ctx, "POST", c.requestURL(path), bytes.NewReader(body))
 	if err != nil {
-		return nil, err
+		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	res, err := c.httpClient.Do(req)
-	if err == nil && res.StatusCode != 200 {
-		return nil, fmt.Errorf("Non-200 status code: %+v", res)
+	res, err := c.do(op, req)
+	if err != nil {
+		return err
 	}
-	return res, err
+	defer drainAndClose(res)
+
+	if apiResp == nil {
+		return nil
+	}
+	buf.Reset()
+	if _, err := buf.ReadFrom(res.Body); err != nil {
+		return err
+	}
+	return json.Unmarshal(buf.Bytes(), apiResp)
+}
+
+// SendPayload encrypts pl for the recipients b64To and distributes it to them,
+// returning the hash the payload is stored under.
+func (c *Client) SendPayload(ctx context.Context, pl []byte, b64From string, b64To []string) (common.EncryptedPayloadHash, error) {
+	return c.SendPayloadWithFlag(ctx, pl, b64From, b64To, PrivacyFlagStandardPrivate)
+}
+
+// SentPayload describes a payload sent with SendPayloadResult.
+type SentPayload struct {
+	Hash common.EncryptedPayloadHash
+
+	// ManagedParties are the keys of the parties managed by the privacy
+	// manager that the payload was sent to, if it reports them.
+	ManagedParties []PublicKey
+}
+
+// SendPayloadResult is like SendPayload, also returning the managed parties
+// the privacy manager reports. Only Tessera's JSON API reports them, so they
+// are only set with WithAPI(JSONAPI).
+func (c *Client) SendPayloadResult(ctx context.Context, pl []byte, b64From string, b64To []string) (*SentPayload, error) {
+	result := c.sendPayload(ctx, pl, b64From, b64To, &SendOptions{})
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	return &SentPayload{Hash: result.Hash, ManagedParties: result.ManagedParties}, nil
 }
 
-func (c *Client) SendPayload(pl []byte, b64From string, b64To []string) ([]byte, error) {
-	buf := bytes.NewBuffer(pl)
-	req, err := http.NewRequest("POST", "http+unix://c/sendraw", buf)
+// SendPayloadWithFlag is like SendPayload, additionally requesting the privacy
+// enhancements selected by flag. Standard private sends carry no flag at all,
+// so they keep working with privacy managers that predate privacy flags.
+func (c *Client) SendPayloadWithFlag(ctx context.Context, pl []byte, b64From string, b64To []string, flag PrivacyFlag) (common.EncryptedPayloadHash, error) {
+	return c.SendPayloadWithOptions(ctx, pl, b64From, b64To, &SendOptions{PrivacyFlag: flag})
+}
+
+// SendPayloadWithOptions is like SendPayload, applying the privacy
+// enhancement settings in opts. Inconsistent options are rejected before
+// anything is sent.
+func (c *Client) SendPayloadWithOptions(ctx context.Context, pl []byte, b64From string, b64To []string, opts *SendOptions) (common.EncryptedPayloadHash, error) {
+	result := c.sendPayload(ctx, pl, b64From, b64To, opts)
+	return result.Hash, result.Err
+}
+
+// sendPayload sends pl through the API selected with WithAPI, deduplicating
+// it if the client has WithSendDeduplication.
+func (c *Client) sendPayload(ctx context.Context, pl []byte, b64From string, b64To []string, opts *SendOptions) SendResult {
+	return c.dedup.send(ctx, func() SendResult {
+		if c.cfg.api == JSONAPI {
+			return c.sendJSON(ctx, pl, b64From, b64To, opts)
+		}
+		hash, err := c.sendRaw(ctx, bytes.NewReader(pl), int64(len(pl)), b64From, b64To, opts)
+		return SendResult{Hash: hash, Err: err}
+	})
+}
+
+// SendPayloadReader is like SendPayload, streaming the payload from r instead
+// of holding it in memory. size is the number of bytes r yields, or -1 if it
+// is unknown. Since the payload can't be replayed, failed requests are never
+// retried.
+func (c *Client) SendPayloadReader(ctx context.Context, r io.Reader, size int64, b64From string, b64To []string) (common.EncryptedPayloadHash, error) {
+	return c.sendRaw(ctx, r, size, b64From, b64To, &SendOptions{})
+}
+
+func (c *Client) sendRaw(ctx context.Context, body io.Reader, size int64, b64From string, b64To []string, opts *SendOptions) (common.EncryptedPayloadHash, error) {
+	b64From = c.sender(b64From)
+	if err := validateKeys(b64From, b64To); err != nil {
+		return common.EncryptedPayloadHash{}, err
+	}
+	if err := opts.validate(b64To); err != nil {
+		return common.EncryptedPayloadHash{}, err
+	}
+	if err := c.checkPayloadSize(size); err != nil {
+		return common.EncryptedPayloadHash{}, err
+	}
+	if size < 0 && c.cfg.maxPayloadSize > 0 {
+		body = &limitedPayload{r: body, left: c.cfg.maxPayloadSize, limit: c.cfg.maxPayloadSize}
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.requestURL("sendraw"), body)
 	if err != nil {
-		return nil, err
+		return common.EncryptedPayloadHash{}, err
+	}
+	if size >= 0 {
+		req.ContentLength = size
 	}
 	if b64From != "" {
 		req.Header.Set("c11n-from", b64From)
 	}
-	req.Header.Set("c11n-to", strings.Join(b64To, ","))
+	c.setRecipients(req.Header, b64To)
+	opts.setHeaders(req.Header)
 	req.Header.Set("Content-Type", "application/octet-stream")
-	res, err := c.httpClient.Do(req)
+	res, err := c.do(opSendRaw, req)
+	if err != nil {
+		return common.EncryptedPayloadHash{}, err
+	}
+	defer res.Body.Close()
 
-	if res != nil {
-		defer res.Body.Close()
+	return decodePayloadHash(res.Body)
+}
+
+// validateKeys checks that the sender key b64From, if set, and the recipient
+// keys b64To are base64 encoded public keys, so that a malformed key is
+// reported by name instead of failing inside the privacy manager.
+func validateKeys(b64From string, b64To []string) error {
+	if b64From != "" {
+		if _, err := ParsePublicKey(b64From); err != nil {
+			return fmt.Errorf("bad sender: %v", err)
+		}
 	}
-	if err != nil {
-		return nil, err
+	for _, to := range b64To {
+		if _, err := ParsePublicKey(to); err != nil {
+			return fmt.Errorf("bad recipient: %v", err)
+		}
 	}
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("Non-200 status code: %+v", res)
+	return nil
+}
+
+// setRecipients adds the recipient keys b64To to a send request, joined by
+// commas or, with WithRepeatedRecipientHeaders, as one header each. Without
+// recipients the header is left out, and the privacy manager keeps the
+// payload for the sender only.
+func (c *Client) setRecipients(h http.Header, b64To []string) {
+	if c.cfg.repeatRecipients {
+		for _, to := range b64To {
+			h.Add("c11n-to", to)
+		}
+		return
 	}
+	if len(b64To) > 0 {
+		h.Set("c11n-to", strings.Join(b64To, ","))
+	}
+}
 
-	return ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, res.Body))
+// checkPayloadSize enforces the configured maximum payload size on a payload
+// of known size.
+func (c *Client) checkPayloadSize(size int64) error {
+	if limit := c.cfg.maxPayloadSize; limit > 0 && size > limit {
+		return &PayloadTooLargeError{Size: size, Limit: limit}
+	}
+	return nil
 }
 
-func (c *Client) StorePayload(pl []byte, b64From string) ([]byte, error) {
-	storeRawReq := &storeRawReq{
-		Payload: base64.StdEncoding.EncodeToString(pl),
-		From:    b64From,
+// limitedPayload fails a streamed payload of unknown size once it has yielded
+// more than the maximum payload size.
+type limitedPayload struct {
+	r     io.Reader
+	left  int64
+	limit int64
+}
+
+func (l *limitedPayload) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.left+1 {
+		p = p[:l.left+1]
 	}
-	buf := new(bytes.Buffer)
-	if err := json.NewEncoder(buf).Encode(storeRawReq); err != nil {
-		return nil, err
+	n, err := l.r.Read(p)
+	if l.left -= int64(n); l.left < 0 {
+		return 0, &PayloadTooLargeError{Size: -1, Limit: l.limit}
 	}
-	req, err := http.NewRequest("POST", "http+unix://c/storeraw", buf)
+	return n, err
+}
+
+// decodePayloadHash reads a base64 encoded payload hash as returned by the
+// privacy manager.
+func decodePayloadHash(r io.Reader) (common.EncryptedPayloadHash, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if _, err := buf.ReadFrom(r); err != nil {
+		return common.EncryptedPayloadHash{}, err
+	}
+	var decoded [2 * common.EncryptedPayloadHashLength]byte
+	if base64.StdEncoding.DecodedLen(buf.Len()) > len(decoded) {
+		return common.EncryptedPayloadHash{}, fmt.Errorf("invalid payload hash length %d, want %d", base64.StdEncoding.DecodedLen(buf.Len()), common.EncryptedPayloadHashLength)
+	}
+	n, err := base64.StdEncoding.Decode(decoded[:], buf.Bytes())
 	if err != nil {
-		return nil, err
+		return common.EncryptedPayloadHash{}, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	res, err := c.httpClient.Do(req)
-
-	if res.StatusCode == http.StatusNotFound {
-		return nil, fmt.Errorf("Non-200 status code, verify that tessera is running and version is 0.10.5+: %v", res)
+	if n != common.EncryptedPayloadHashLength {
+		return common.EncryptedPayloadHash{}, fmt.Errorf("invalid payload hash length %d, want %d", n, common.EncryptedPayloadHashLength)
 	}
+	return common.BytesToEncryptedPayloadHash(decoded[:n]), nil
+}
 
-	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Non-200 status code: %+v", res)
+// StorePayload encrypts pl for b64From, or the privacy manager's default key,
+// and stores it locally without distributing it, returning the decoded hash.
+// The stored payload is sent to its recipients later with SendSignedPayload.
+// This uses Tessera's /storeraw API, available from version 0.10.5.
+func (c *Client) StorePayload(ctx context.Context, pl []byte, b64From string) ([]byte, error) {
+	b64From = c.sender(b64From)
+	if err := validateKeys(b64From, nil); err != nil {
+		return nil, err
+	}
+	if err := c.checkPayloadSize(int64(len(pl))); err != nil {
+		return nil, err
+	}
+	storeRawReq := &storeRawReq{
+		Payload: base64.StdEncoding.EncodeToString(pl),
+		From:    b64From,
 	}
-	// parse response
 	var storeRawResp storeRawResp
-	if err := json.NewDecoder(res.Body).Decode(&storeRawResp); err != nil {
+	err := c.doJson(ctx, opStoreRaw, "storeraw", storeRawReq, &storeRawResp)
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound {
+		return nil, fmt.Errorf("%v, verify that tessera is running and version is 0.10.5+", err)
+	}
+	if err != nil {
 		return nil, err
 	}
 	encryptedPayloadHash, err := base64.StdEncoding.DecodeString(storeRawResp.Key)
@@ -155,112 +458,557 @@ func (c *Client) StorePayload(pl []byte, b64From string) ([]byte, error) {
 	return encryptedPayloadHash, nil
 }
 
-func (c *Client) SendSignedPayload(signedPayload []byte, b64To []string) ([]byte, error) {
+// SendSignedPayload distributes a payload stored with StorePayload to the
+// recipients b64To. signedPayload is the data of the signed private
+// transaction, i.e. the hash StorePayload returned.
+func (c *Client) SendSignedPayload(ctx context.Context, signedPayload []byte, b64To []string) ([]byte, error) {
+	if err := validateKeys("", b64To); err != nil {
+		return nil, err
+	}
+	if c.cfg.checkSignedPayloads {
+		if err := checkSignedPayload(signedPayload); err != nil {
+			return nil, err
+		}
+	}
 	buf := bytes.NewBuffer(signedPayload)
-	req, err := http.NewRequest("POST", "http+unix://c/sendsignedtx", buf)
+	req, err := http.NewRequestWithContext(ctx, "POST", c.requestURL("sendsignedtx"), buf)
 	if err != nil {
 		return nil, err
 	}
-
-	req.Header.Set("c11n-to", strings.Join(b64To, ","))
+	c.setRecipients(req.Header, b64To)
 	req.Header.Set("Content-Type", "application/octet-stream")
-	res, err := c.httpClient.Do(req)
+	res, err := c.do(opSendSignedTx, req, "hash", common.BytesToEncryptedPayloadHash(signedPayload).TerminalString())
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	return ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, res.Body))
+}
 
-	if res != nil {
+// checkSignedPayload checks that signedPayload has the form of a hash returned
+// by StorePayload. The signature of the transaction carrying it is not part of
+// the payload, so it can only be checked by the caller.
+func checkSignedPayload(signedPayload []byte) error {
+	if len(signedPayload) != common.EncryptedPayloadHashLength {
+		return fmt.Errorf("signed payload is %d bytes long, want a %d byte payload hash", len(signedPayload), common.EncryptedPayloadHashLength)
+	}
+	if common.BytesToEncryptedPayloadHash(signedPayload) == (common.EncryptedPayloadHash{}) {
+		return errors.New("signed payload is an empty payload hash")
+	}
+	return nil
+}
+
+// ReceivePayload returns the payload stored under key. /receiveraw serves the
+// payload as raw bytes, and they are returned verbatim; nothing is base64
+// decoded on the way, so payloads that are themselves base64 text come back
+// unchanged. It returns ErrPayloadNotFound if the privacy manager doesn't know
+// the key, which is expected for transactions the node isn't party to.
+func (c *Client) ReceivePayload(ctx context.Context, key []byte) ([]byte, error) {
+	return c.ReceivePayloadFor(ctx, key, "")
+}
+
+// ReceivePayloadFor is like ReceivePayload, decrypting the payload with the
+// recipient key b64To. Privacy managers holding keys of several parties need
+// it to pick the right one; an empty b64To lets the privacy manager choose.
+func (c *Client) ReceivePayloadFor(ctx context.Context, key []byte, b64To string) ([]byte, error) {
+	cacheKey := base64.StdEncoding.EncodeToString(key)
+	if b64To != "" {
+		if err := validateKeys("", []string{b64To}); err != nil {
+			return nil, err
+		}
+		cacheKey += "/" + b64To
+	}
+	if c.payloads != nil {
+		pl, ok := c.payloads.get(cacheKey)
+		c.metrics.cacheLookup("receive", ok)
+		if ok {
+			return pl, nil
+		}
+	}
+	var pl []byte
+	if c.cfg.api == JSONAPI {
+		received, err := c.ReceiveJSON(ctx, key, b64To)
+		if err != nil {
+			return nil, err
+		}
+		pl = received.Payload
+	} else {
+		res, err := c.receiveRaw(ctx, key, b64To)
+		if err != nil {
+			return nil, err
+		}
 		defer res.Body.Close()
+
+		if pl, err = ioutil.ReadAll(res.Body); err != nil {
+			return nil, err
+		}
+		if c.cfg.verifyPayloads && len(key) > 0 && len(pl) == 0 {
+			return nil, ErrEmptyPayload
+		}
 	}
+	c.payloads.add(cacheKey, pl)
+	return pl, nil
+}
+
+// ReceivePayloadStream is like ReceivePayload, returning the payload as it is
+// read from the privacy manager instead of buffering it. /receiveraw serves the
+// payload as raw bytes, so nothing needs decoding on the way. The caller must
+// close the returned reader, which also ends the request if the payload hasn't
+// been read to the end.
+func (c *Client) ReceivePayloadStream(ctx context.Context, key []byte) (io.ReadCloser, error) {
+	res, err := c.receiveRaw(ctx, key, "")
 	if err != nil {
 		return nil, err
 	}
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("Non-200 status code: %+v", res)
+	return res.Body, nil
+}
+
+// ReceivePayloadWithMeta is like ReceivePayload, also returning the details
+// the privacy manager sent along with the payload. It always queries the
+// privacy manager, bypassing the payload cache.
+func (c *Client) ReceivePayloadWithMeta(ctx context.Context, key []byte) ([]byte, *ReceiveMeta, error) {
+	if c.cfg.api == JSONAPI {
+		received, err := c.ReceiveJSON(ctx, key, "")
+		if err != nil {
+			return nil, nil, err
+		}
+		meta, err := received.meta()
+		if err != nil {
+			return nil, nil, err
+		}
+		return received.Payload, meta, nil
+	}
+	res, err := c.receiveRaw(ctx, key, "")
+	if err != nil {
+		return nil, nil, err
 	}
+	defer res.Body.Close()
 
-	return ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, res.Body))
+	meta, err := parseReceiveMeta(res.Header)
+	if err != nil {
+		return nil, nil, err
+	}
+	pl, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.cfg.verifyPayloads && len(key) > 0 && len(pl) == 0 {
+		return nil, nil, ErrEmptyPayload
+	}
+	return pl, meta, nil
 }
 
-func (c *Client) ReceivePayload(key []byte) ([]byte, error) {
-	req, err := http.NewRequest("GET", "http+unix://c/receiveraw", nil)
+// receiveRaw requests the payload stored under key, decrypted for b64To if
+// it is set. The caller must close the response body. A privacy manager that
+// holds no payload under key, e.g. because the node isn't a recipient, answers
+// 404, which is reported as ErrPayloadNotFound.
+func (c *Client) receiveRaw(ctx context.Context, key []byte, b64To string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.requestURL("receiveraw"), nil)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("c11n-key", base64.StdEncoding.EncodeToString(key))
-	res, err := c.httpClient.Do(req)
+	if b64To != "" {
+		req.Header.Set("c11n-to", b64To)
+	}
+	res, err := c.do(opReceiveRaw, req, "hash", common.BytesToEncryptedPayloadHash(key).TerminalString())
 
-	if res != nil {
-		defer res.Body.Close()
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound {
+		return nil, ErrPayloadNotFound
+	}
+	return res, err
+}
+
+// DeletePayload removes the payload stored under key from the local privacy
+// manager only; copies held by the other participants are not affected. It
+// returns ErrPayloadNotFound if the privacy manager doesn't know the key.
+func (c *Client) DeletePayload(ctx context.Context, key []byte) error {
+	err := c.doJson(ctx, opDelete, "delete", &deleteReq{Key: base64.StdEncoding.EncodeToString(key)}, nil)
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound {
+		return ErrPayloadNotFound
 	}
+	return err
+}
+
+// Push hands an encoded payload, as forwarded between privacy managers, to the
+// local node for storage and returns the hash it is stored under. Pushing a
+// payload the node already holds fails with ErrPayloadExists.
+func (c *Client) Push(ctx context.Context, encodedPayload []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.requestURL("push"), bytes.NewReader(encodedPayload))
 	if err != nil {
 		return nil, err
 	}
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("Non-200 status code: %+v", res)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	res, err := c.do(opPush, req)
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Code == http.StatusConflict {
+		return nil, ErrPayloadExists
+	}
+	if err != nil {
+		return nil, err
 	}
+	defer res.Body.Close()
 
-	return ioutil.ReadAll(res.Body)
+	return ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, res.Body))
+}
+
+// ResendForKey asks the local privacy manager to have its peers push every
+// payload they hold for b64PublicKey, e.g. to recover a node restored from a
+// backup. The payloads arrive asynchronously after the call has returned.
+func (c *Client) ResendForKey(ctx context.Context, b64PublicKey string) error {
+	return c.doJson(ctx, opResend, "resend", &resendReq{Type: "ALL", PublicKey: b64PublicKey}, nil)
 }
 
-func (c *Client) IsSender(txHash common.EncryptedPayloadHash) (bool, error) {
-	req, err := http.NewRequest("GET", "http+unix://c/transaction/"+url.PathEscape(txHash.ToBase64())+"/isSender", nil)
+// ResendIndividual asks the privacy manager to push the payload stored under
+// txHash to the recipient b64PublicKey again. It returns ErrPayloadNotFound
+// if the privacy manager doesn't know the hash.
+func (c *Client) ResendIndividual(ctx context.Context, b64PublicKey string, txHash common.EncryptedPayloadHash) error {
+	resendReq := &resendReq{
+		Type:      "INDIVIDUAL",
+		PublicKey: b64PublicKey,
+		Key:       txHash.ToBase64(),
+	}
+	err := c.doJson(ctx, opResend, "resend", resendReq, nil)
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound {
+		return ErrPayloadNotFound
+	}
+	return err
+}
+
+func (c *Client) IsSender(ctx context.Context, txHash common.EncryptedPayloadHash) (bool, error) {
+	cacheKey := "issender/" + txHash.ToBase64()
+	if c.txInfo != nil {
+		isSender, ok := c.txInfo.get(cacheKey)
+		c.metrics.cacheLookup("issender", ok)
+		if ok {
+			return isSender.(bool), nil
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", c.requestURL(transactionPath(txHash, "isSender")), nil)
 	if err != nil {
 		return false, err
 	}
 
-	res, err := c.httpClient.Do(req)
+	res, err := c.do(opIsSender, req, "hash", txHash.TerminalString())
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
 
-	if res != nil {
-		defer res.Body.Close()
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if _, err := buf.ReadFrom(res.Body); err != nil {
+		return false, err
 	}
 
+	// Node variants differ in case and trailing newlines.
+	var isSender bool
+	switch out := bytes.TrimSpace(buf.Bytes()); {
+	case bytes.EqualFold(out, []byte("true")):
+		isSender = true
+	case bytes.EqualFold(out, []byte("false")):
+	default:
+		return false, fmt.Errorf("unexpected isSender response %q", out)
+	}
+	c.txInfo.set(cacheKey, isSender)
+	return isSender, nil
+}
+
+// transactionPath returns the path of a /transaction/{hash}/... endpoint, or
+// of /transaction/{hash} itself if endpoint is empty.
+// Tessera decodes the hash as standard, not URL-safe, base64 after undoing
+// the percent-encoding of the path, so its '/' characters are escaped to keep
+// them from being taken as path separators, while '+' and '=' are valid in a
+// path segment and passed as they are.
+func transactionPath(txHash common.EncryptedPayloadHash, endpoint string) string {
+	path := "transaction/" + url.PathEscape(txHash.ToBase64())
+	if endpoint != "" {
+		path += "/" + endpoint
+	}
+	return path
+}
+
+// GetParticipants returns the keys of the parties to the payload stored under
+// txHash. The result is empty, not nil, if there are none.
+func (c *Client) GetParticipants(ctx context.Context, txHash common.EncryptedPayloadHash) ([]PublicKey, error) {
+	cacheKey := "participants/" + txHash.ToBase64()
+	if c.txInfo != nil {
+		participants, ok := c.txInfo.get(cacheKey)
+		c.metrics.cacheLookup("participants", ok)
+		if ok {
+			return append([]PublicKey{}, participants.([]PublicKey)...), nil
+		}
+	}
+	requestUrl := c.requestURL(transactionPath(txHash, "participants"))
+	req, err := http.NewRequestWithContext(ctx, "GET", requestUrl, nil)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	if res.StatusCode != 200 {
-		return false, fmt.Errorf("non-200 status code: %+v", res)
+	res, err := c.do(opGetParticipants, req, "hash", txHash.TerminalString())
+	if err != nil {
+		return nil, err
 	}
+	defer res.Body.Close()
 
 	out, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	return strconv.ParseBool(string(out))
+	participants := []PublicKey{}
+	if len(bytes.TrimSpace(out)) > 0 {
+		for _, b64 := range strings.Split(string(out), ",") {
+			key, err := ParsePublicKey(strings.TrimSpace(b64))
+			if err != nil {
+				return nil, err
+			}
+			participants = append(participants, key)
+		}
+	}
+	c.txInfo.set(cacheKey, append([]PublicKey{}, participants...))
+	return participants, nil
+}
+
+// Validate checks that the sockets of a unix socket client exist, so that a
+// wrong path or a privacy manager that hasn't started yet is reported clearly
+// instead of failing the first request with a dial error. A socket that any
+// user may connect to, and so have payloads decrypted, is logged as a warning,
+// or rejected with WithStrictSocketPermissions. A failover client only needs
+// one of its sockets to exist; the others are logged as warnings, as
+// requests fail over past them.
+func (c *Client) Validate() error {
+	c.connMu.RLock()
+	sockets := c.sockets
+	c.connMu.RUnlock()
+
+	var errs []error
+	for _, socketPath := range sockets {
+		err := validateSocket(socketPath, c.cfg)
+		if _, insecure := err.(*insecureSocketError); insecure {
+			return err
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 && len(errs) == len(sockets) {
+		return errs[0]
+	}
+	for _, err := range errs {
+		c.cfg.logger.Warn("Privacy manager socket unavailable", "err", err)
+	}
+	return nil
 }
 
-func (c *Client) GetParticipants(txHash common.EncryptedPayloadHash) ([]string, error) {
-	requestUrl := "http+unix://c/transaction/" + url.PathEscape(txHash.ToBase64()) + "/participants"
-	req, err := http.NewRequest("GET", requestUrl, nil)
+// insecureSocketError rejects a socket that any user may connect to.
+type insecureSocketError struct {
+	socket string
+	perm   os.FileMode
+}
+
+func (e *insecureSocketError) Error() string {
+	return fmt.Sprintf("privacy manager socket %s is writable by all users (mode %v)", e.socket, e.perm)
+}
+
+func validateSocket(socketPath string, cfg *clientConfig) error {
+	if isAbstractSocket(socketPath) || isNamedPipe(socketPath) {
+		// Abstract sockets and pipes have no file to look for, only a listener.
+		conn, err := dialSocket(context.Background(), socketPath, cfg.dialTimeout)
+		if err != nil {
+			return fmt.Errorf("privacy manager socket %s does not exist: %v", socketPath, err)
+		}
+		return conn.Close()
+	}
+	info, err := os.Stat(socketPath)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("privacy manager socket %s does not exist", socketPath)
+	}
 	if err != nil {
-		return nil, err
+		return err
 	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("privacy manager socket %s is not a unix socket", socketPath)
+	}
+	// Connecting to a socket takes write permission on it. Windows doesn't
+	// keep unix permission bits.
+	if perm := info.Mode().Perm(); perm&0002 != 0 && runtime.GOOS != "windows" {
+		if cfg.strictSocketPerms {
+			return &insecureSocketError{socket: socketPath, perm: perm}
+		}
+		cfg.logger.Warn("Privacy manager socket is writable by all users", "socket", socketPath, "mode", perm)
+	}
+	return nil
+}
 
-	res, err := c.httpClient.Do(req)
+// Close cancels the requests in progress and releases the connections held by
+// the client, so that shutting down isn't held up by a stuck call. Calls made
+// after Close, and those it interrupts, fail with ErrClientClosed.
+func (c *Client) Close() error {
+	c.inflight.close()
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	closeIdleConnections(c.httpClient, c.transport)
+	return nil
+}
 
-	if res != nil {
-		defer res.Body.Close()
+// closeIdleConnections closes the idle connections of httpClient, whose own
+// transport, before WithRoundTripper, is transport.
+func closeIdleConnections(httpClient *http.Client, transport http.RoundTripper) {
+	httpClient.CloseIdleConnections()
+	// A transport installed by WithRoundTripper may not pass the call on.
+	if t, ok := transport.(interface{ CloseIdleConnections() }); ok {
+		t.CloseIdleConnections()
 	}
+}
 
-	if err != nil {
-		return nil, err
+// SetSocketPath points a client created by NewClient at the privacy manager
+// socket socketPath, e.g. after the privacy manager has moved, without
+// creating a new client. The socket is validated first, and the client is
+// left unchanged if it is unusable. Requests already in progress complete on
+// the old socket; new ones use the new socket, and idle connections to the old
+// one are closed.
+func (c *Client) SetSocketPath(socketPath string) error {
+	if c.baseURL != unixBaseURL {
+		return errors.New("client does not connect through a unix socket")
+	}
+	if err := validateSocket(socketPath, c.cfg); err != nil {
+		return err
 	}
+	transport := unixTransport(socketPath, c.cfg)
+	httpClient := &http.Client{Transport: c.cfg.wrap(transport)}
+
+	c.connMu.Lock()
+	oldClient, oldTransport := c.httpClient, c.transport
+	c.httpClient, c.transport, c.sockets = httpClient, transport, []string{socketPath}
+	c.connMu.Unlock()
+
+	closeIdleConnections(oldClient, oldTransport)
+	return nil
+}
+
+// currentHTTPClient returns the HTTP client requests are sent with.
+func (c *Client) currentHTTPClient() *http.Client {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	return c.httpClient
+}
 
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("Non-200 status code: %+v", res)
+// InFlight returns the number of requests the client has in progress, i.e.
+// sent or waiting to be retried, whose response has not been read yet.
+func (c *Client) InFlight() int {
+	return c.inflight.count()
+}
+
+// ClearCache drops all payloads and transaction details cached by the client.
+func (c *Client) ClearCache() {
+	c.payloads.purge()
+	c.txInfo.flush()
+}
+
+// GetVersion returns the version reported by the privacy manager.
+func (c *Client) GetVersion(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.requestURL("version"), nil)
+	if err != nil {
+		return "", err
+	}
+	res, err := c.do(opVersion, req)
+	if err != nil {
+		return "", err
 	}
+	defer res.Body.Close()
 
 	out, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// NewClient creates a client for the privacy manager listening on socketPath,
+// which on Linux may name an abstract socket such as "@tessera" and on Windows
+// a named pipe such as \\.\pipe\tessera.
+// Without options the transport uses a 1s dial timeout and 5s request and
+// response header timeouts.
+func NewClient(socketPath string, opts ...Option) (*Client, error) {
+	cfg := newClientConfig(opts)
+	c, err := newClient(&http.Client{Transport: unixTransport(socketPath, cfg)}, unixBaseURL, cfg)
 	if err != nil {
 		return nil, err
 	}
+	c.sockets = []string{socketPath}
+	return c, nil
+}
 
-	split := strings.Split(string(out), ",")
+// NewClientFromURL creates a client for a privacy manager listening on TCP,
+// addressed by an http:// or https:// base URL such as "http://127.0.0.1:9080".
+// API paths are resolved relative to the base URL.
+func NewClientFromURL(baseURL string, opts ...Option) (*Client, error) {
+	baseURL, err := parseBaseURL(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	cfg := newClientConfig(opts)
+	return newClient(&http.Client{Transport: tcpTransport(cfg)}, baseURL, cfg)
+}
 
-	return split, nil
+// parseBaseURL validates an http:// or https:// privacy manager URL and
+// normalises it into a base that API paths can be appended to.
+func parseBaseURL(baseURL string) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported privacy manager URL scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("privacy manager URL %q has no host", baseURL)
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	u.RawQuery, u.Fragment = "", ""
+	return u.String(), nil
 }
 
-func NewClient(socketPath string) (*Client, error) {
-	return &Client{
-		httpClient: unixClient(socketPath),
-	}, nil
+func newClient(httpClient *http.Client, baseURL string, cfg *clientConfig) (*Client, error) {
+	c := &Client{
+		httpClient: httpClient,
+		transport:  httpClient.Transport,
+		baseURL:    baseURL,
+		cfg:        cfg,
+		inflight:   newInflight(cfg),
+	}
+	httpClient.Transport = cfg.wrap(httpClient.Transport)
+	if cfg.metrics != nil {
+		c.metrics = newClientMetrics(cfg.metrics)
+	}
+	if cfg.dedupTTL > 0 {
+		c.dedup = newSendDedup(cfg.dedupTTL)
+	}
+	if cfg.expvarName != "" {
+		expvars, err := newExpvarCounters(cfg.expvarName)
+		if err != nil {
+			return nil, err
+		}
+		c.expvars = expvars
+	}
+	if cfg.payloadCacheEntries > 0 || cfg.payloadCacheBytes > 0 {
+		c.payloads = newPayloadCache(cfg.payloadCacheEntries, cfg.payloadCacheBytes)
+	}
+	if cfg.txInfoCacheTTL > 0 {
+		c.txInfo = newTxInfoCache(cfg.txInfoCacheTTL, cfg.txInfoCacheEntries)
+	}
+	if cfg.rateLimit > 0 {
+		c.limiter = rate.NewLimiter(cfg.rateLimit, cfg.rateBurst)
+	}
+	return c, nil
 }
@@ -0,0 +1,1398 @@
+package privatetransactionmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// newTestServer starts an HTTP server listening on a unix socket in a fresh
+// temporary directory and returns the socket path.
+func newTestServer(t testing.TB, handler http.Handler) (string, func()) {
+	return startTestServer(t, httptest.NewUnstartedServer(handler))
+}
+
+// startTestServer is like newTestServer, for servers needing more setup.
+func startTestServer(t testing.TB, srv *httptest.Server) (string, func()) {
+	dir, err := ioutil.TempDir("", "ptm-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	socketPath := filepath.Join(dir, "tm.ipc")
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	srv.Listener = l
+	srv.Start()
+	return socketPath, func() {
+		srv.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// testPayloadHash is the payload hash returned by test servers for sends.
+var testPayloadHash = common.BytesToEncryptedPayloadHash([]byte("hash"))
+
+// testRecipient is a recipient public key for test sends.
+var testRecipient = testKey(1)
+
+// testKey returns a base64 encoded public key made of the byte b.
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, publicKeyLength))
+}
+
+func TestSendPayload(t *testing.T) {
+	short := testKey(2)
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("c11n-to") == short {
+			w.Write([]byte(base64.StdEncoding.EncodeToString([]byte("hash"))))
+			return
+		}
+		w.Write([]byte(testPayloadHash.ToBase64()))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := c.SendPayload(context.Background(), []byte("payload"), "", []string{testRecipient})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != testPayloadHash {
+		t.Fatalf("got hash %x, want %x", hash, testPayloadHash)
+	}
+	if _, err := c.SendPayload(context.Background(), []byte("payload"), "", []string{short}); err == nil {
+		t.Fatal("expected error for truncated payload hash")
+	}
+}
+
+func TestDefaultSender(t *testing.T) {
+	var from string
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		from = r.Header.Get("c11n-from")
+		w.Write([]byte(testPayloadHash.ToBase64()))
+	}))
+	defer shutdown()
+
+	def, explicit := testKey(5), testKey(6)
+	c, err := NewClient(socketPath, WithDefaultSender(def))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SendPayload(context.Background(), []byte("payload"), "", []string{testRecipient}); err != nil {
+		t.Fatal(err)
+	}
+	if from != def {
+		t.Fatalf("got sender %q, want default %q", from, def)
+	}
+	if _, err := c.SendPayload(context.Background(), []byte("payload"), explicit, []string{testRecipient}); err != nil {
+		t.Fatal(err)
+	}
+	if from != explicit {
+		t.Fatalf("got sender %q, want %q", from, explicit)
+	}
+}
+
+func TestSendPayloadRecipients(t *testing.T) {
+	var to []string
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		to = r.Header["C11n-To"]
+		w.Write([]byte(testPayloadHash.ToBase64()))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SendPayload(context.Background(), []byte("payload"), "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if to != nil {
+		t.Fatalf("got recipients header %q without recipients", to)
+	}
+	short := base64.StdEncoding.EncodeToString([]byte("short"))
+	for _, invalid := range [][]string{{""}, {testRecipient, "not base64!"}, {short}} {
+		if _, err := c.SendPayload(context.Background(), []byte("payload"), "", invalid); err == nil {
+			t.Fatalf("expected error for recipients %q", invalid)
+		}
+	}
+	if _, err := c.SendPayload(context.Background(), []byte("payload"), short, []string{testRecipient}); err == nil || !strings.Contains(err.Error(), short) {
+		t.Fatalf("got error %v, want one naming sender %s", err, short)
+	}
+	if _, err := c.SendSignedPayload(context.Background(), []byte("signed"), []string{short}); err == nil || !strings.Contains(err.Error(), short) {
+		t.Fatalf("got error %v, want one naming recipient %s", err, short)
+	}
+	opts := &SendOptions{PrivacyFlag: PrivacyFlagMandatoryRecipients, MandatoryRecipients: []string{testRecipient}}
+	if _, err := c.SendPayloadWithOptions(context.Background(), []byte("payload"), "", nil, opts); err != ErrNoRecipients {
+		t.Fatalf("got error %v, want %v", err, ErrNoRecipients)
+	}
+}
+
+func TestRepeatedRecipientHeaders(t *testing.T) {
+	var to []string
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		to = r.Header["C11n-To"]
+		w.Write([]byte(testPayloadHash.ToBase64()))
+	}))
+	defer shutdown()
+
+	recipients := []string{testKey(1), testKey(2)}
+	for _, tt := range []struct {
+		opts []Option
+		want []string
+	}{
+		{nil, []string{recipients[0] + "," + recipients[1]}},
+		{[]Option{WithRepeatedRecipientHeaders()}, recipients},
+	} {
+		c, err := NewClient(socketPath, tt.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.SendPayload(context.Background(), []byte("payload"), "", recipients); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(to, tt.want) {
+			t.Fatalf("got recipient headers %q, want %q", to, tt.want)
+		}
+		if _, err := c.SendSignedPayload(context.Background(), testPayloadHash.Bytes(), recipients); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(to, tt.want) {
+			t.Fatalf("got recipient headers %q for signed payload, want %q", to, tt.want)
+		}
+	}
+}
+
+func TestSendPayloadContextCancel(t *testing.T) {
+	aborted := make(chan struct{})
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server only notices a closed connection once the body has
+		// been consumed, then blocks until the client tears down the request.
+		ioutil.ReadAll(r.Body)
+		<-r.Context().Done()
+		close(aborted)
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := c.SendPayload(ctx, []byte("payload"), "", []string{testRecipient}); err == nil {
+		t.Fatal("expected error from cancelled request")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("cancelled request took %v", elapsed)
+	}
+	select {
+	case <-aborted:
+	case <-time.After(time.Second):
+		t.Fatal("server did not observe the request being torn down")
+	}
+}
+
+func TestResponseHeaderTimeout(t *testing.T) {
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Stall before sending the headers.
+		<-r.Context().Done()
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath, WithResponseHeaderTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = c.GetVersion(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "timeout awaiting response headers") {
+		t.Fatalf("got error %v, want response header timeout", err)
+	}
+	// The request timeout of 5s would have taken longer.
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("response header timeout took %v", elapsed)
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	release := make(chan struct{})
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/receiveraw" {
+			// Stall the body after sending the headers.
+			w.Write([]byte("partial"))
+			w.(http.Flusher).Flush()
+		} else {
+			time.Sleep(200 * time.Millisecond)
+		}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer shutdown()
+	defer close(release)
+
+	c, err := NewClient(socketPath, WithRequestTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetVersion(context.Background()); err == nil {
+		t.Fatal("expected request timeout")
+	}
+	if _, err := c.ReceivePayload(context.Background(), []byte("key")); err == nil {
+		t.Fatal("expected request timeout while reading the body")
+	}
+
+	// An extended call timeout lets the slow request complete once released.
+	time.AfterFunc(300*time.Millisecond, func() { release <- struct{}{} })
+	if _, err := c.GetVersion(WithCallTimeout(context.Background(), 5*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A shorter context deadline still applies.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.GetVersion(WithCallTimeout(ctx, 5*time.Second)); err == nil {
+		t.Fatal("expected context deadline to end the call")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("call took %v", elapsed)
+	}
+}
+
+func TestContextDeadline(t *testing.T) {
+	release := make(chan struct{})
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer shutdown()
+	defer close(release)
+
+	// The context's 500ms deadline ends calls well before the client's 5s
+	// request and response header timeouts, also while waiting for a
+	// restarting privacy manager to accept connections.
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarting, err := NewClient(filepath.Join(filepath.Dir(socketPath), "restarting.ipc"), WithRestartWait(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := map[string]func(context.Context) error{
+		"version": func(ctx context.Context) error {
+			_, err := c.GetVersion(ctx)
+			return err
+		},
+		"send": func(ctx context.Context) error {
+			_, err := c.SendPayload(ctx, []byte("payload"), "", []string{testRecipient})
+			return err
+		},
+		"restarting": func(ctx context.Context) error {
+			_, err := restarting.GetVersion(ctx)
+			return err
+		},
+	}
+	for name, call := range calls {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		start := time.Now()
+		err := call(ctx)
+		elapsed := time.Since(start)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("%s: got error %v, want %v", name, err, context.DeadlineExceeded)
+		}
+		if elapsed < 400*time.Millisecond || elapsed > 2*time.Second {
+			t.Fatalf("%s: call with 500ms deadline took %v", name, elapsed)
+		}
+	}
+}
+
+func TestNewClientFromURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tessera/receiveraw" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("payload"))
+	}))
+	defer srv.Close()
+
+	c, err := NewClientFromURL(srv.URL + "/tessera")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl, err := c.ReceivePayload(context.Background(), []byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(pl) != "payload" {
+		t.Fatalf("got payload %q, want %q", pl, "payload")
+	}
+}
+
+func TestNewClientFromURLRejectsScheme(t *testing.T) {
+	if _, err := NewClientFromURL("unix:///tmp/tm.ipc"); err == nil {
+		t.Fatal("expected error for non-http scheme")
+	}
+}
+
+// connCounter counts the connections accepted by a test server.
+type connCounter int32
+
+func (n *connCounter) track(_ net.Conn, state http.ConnState) {
+	if state == http.StateNew {
+		atomic.AddInt32((*int32)(n), 1)
+	}
+}
+
+func (n *connCounter) count() int {
+	return int(atomic.LoadInt32((*int32)(n)))
+}
+
+// waitForGoroutines waits for the number of goroutines to drop back to at most
+// want, failing the test if it doesn't within a second.
+func waitForGoroutines(t *testing.T, want int) {
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > want {
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines leaked: have %d, want at most %d", runtime.NumGoroutine(), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDoJsonReleasesConnections(t *testing.T) {
+	var conns connCounter
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			http.Error(w, "failure", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"key":"a2V5","unused":"` + strings.Repeat("x", 8192) + `"}`))
+	}))
+	srv.Config.ConnState = conns.track
+	socketPath, shutdown := startTestServer(t, srv)
+	defer shutdown()
+
+	baseline := runtime.NumGoroutine()
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		var resp storeRawResp
+		if err := c.doJson(context.Background(), opStoreRaw, "storeraw", &storeRawReq{}, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.doJson(context.Background(), opStoreRaw, "fail", &storeRawReq{}, nil); err == nil {
+			t.Fatal("expected error for failing request")
+		}
+	}
+	if n := conns.count(); n != 1 {
+		t.Fatalf("requests used %d connections, want 1", n)
+	}
+	c.httpClient.CloseIdleConnections()
+	waitForGoroutines(t, baseline)
+}
+
+func TestGetVersion(t *testing.T) {
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("0.10.2\n"))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := c.GetVersion(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "0.10.2" {
+		t.Fatalf("got version %q, want %q", version, "0.10.2")
+	}
+}
+
+func TestDeletePayload(t *testing.T) {
+	stored := base64.StdEncoding.EncodeToString([]byte("stored"))
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req deleteReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.URL.Path != "/delete" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if req.Key != stored {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("Delete successful"))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeletePayload(context.Background(), []byte("stored")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeletePayload(context.Background(), []byte("unknown")); err != ErrPayloadNotFound {
+		t.Fatalf("got error %v, want %v", err, ErrPayloadNotFound)
+	}
+}
+
+func TestPush(t *testing.T) {
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) == "duplicate" {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(base64.StdEncoding.EncodeToString([]byte("hash"))))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := c.Push(context.Background(), []byte("encoded"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(hash) != "hash" {
+		t.Fatalf("got hash %q, want %q", hash, "hash")
+	}
+	if _, err := c.Push(context.Background(), []byte("duplicate")); err != ErrPayloadExists {
+		t.Fatalf("got error %v, want %v", err, ErrPayloadExists)
+	}
+}
+
+func TestResend(t *testing.T) {
+	var got []resendReq
+	known := common.BytesToEncryptedPayloadHash([]byte("known"))
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req resendReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.URL.Path != "/resend" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		got = append(got, req)
+		if req.Type == "INDIVIDUAL" && req.Key != known.ToBase64() {
+			http.NotFound(w, r)
+		}
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ResendForKey(context.Background(), "recipient"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ResendIndividual(context.Background(), "recipient", known); err != nil {
+		t.Fatal(err)
+	}
+	unknown := common.BytesToEncryptedPayloadHash([]byte("unknown"))
+	if err := c.ResendIndividual(context.Background(), "recipient", unknown); err != ErrPayloadNotFound {
+		t.Fatalf("got error %v, want %v", err, ErrPayloadNotFound)
+	}
+	want := []resendReq{
+		{Type: "ALL", PublicKey: "recipient"},
+		{Type: "INDIVIDUAL", PublicKey: "recipient", Key: known.ToBase64()},
+		{Type: "INDIVIDUAL", PublicKey: "recipient", Key: unknown.ToBase64()},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got requests %+v, want %+v", got, want)
+	}
+}
+
+func TestStorePayload(t *testing.T) {
+	sender := testKey(4)
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req storeRawReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.URL.Path != "/storeraw" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if req.Payload != base64.StdEncoding.EncodeToString([]byte("payload")) || req.From != sender {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(&storeRawResp{Key: base64.StdEncoding.EncodeToString([]byte("hash"))})
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := c.StorePayload(context.Background(), []byte("payload"), sender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(hash) != "hash" {
+		t.Fatalf("got hash %q, want %q", hash, "hash")
+	}
+	if _, err := c.StorePayload(context.Background(), []byte("payload"), "sender"); err == nil {
+		t.Fatal("expected error for invalid sender")
+	}
+}
+
+func TestSendPayloadWithFlag(t *testing.T) {
+	var flags []string
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flag, ok := r.Header["C11n-Privacy-Flag"]
+		if !ok {
+			flag = []string{"none"}
+		}
+		flags = append(flags, flag...)
+		w.Write([]byte(testPayloadHash.ToBase64()))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SendPayload(context.Background(), []byte("payload"), "", []string{testRecipient}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SendPayloadWithFlag(context.Background(), []byte("payload"), "", []string{testRecipient}, PrivacyFlagPartyProtection); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"none", "1"}; !reflect.DeepEqual(flags, want) {
+		t.Fatalf("got privacy flags %q, want %q", flags, want)
+	}
+}
+
+func TestTransactionPathEncoding(t *testing.T) {
+	// 0xfb 0xff 0xfb encodes to "+//7", and 64 byte hashes end in "==" padding.
+	hash := common.BytesToEncryptedPayloadHash(append([]byte{0xfb, 0xff, 0xfb, 0xff}, bytes.Repeat([]byte{0xfb, 0xef, 0xbe}, 20)...))
+	b64 := hash.ToBase64()
+	if !strings.Contains(b64, "+") || !strings.Contains(b64, "/") || !strings.HasSuffix(b64, "==") {
+		t.Fatalf("test hash %s lacks characters to escape", b64)
+	}
+	var paths []string
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		switch r.URL.Path {
+		case "/transaction/" + b64 + "/isSender":
+			w.Write([]byte("true"))
+		case "/transaction/" + b64 + "/participants":
+			w.Write([]byte(testRecipient))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isSender, err := c.IsSender(context.Background(), hash); err != nil || !isSender {
+		t.Fatalf("got isSender %t, %v", isSender, err)
+	}
+	if _, err := c.GetParticipants(context.Background(), hash); err != nil {
+		t.Fatal(err)
+	}
+	escaped := "/transaction/" + strings.Replace(b64, "/", "%2F", -1)
+	if want := []string{escaped + "/isSender", escaped + "/participants"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("got paths %q, want %q", paths, want)
+	}
+}
+
+func TestIsSender(t *testing.T) {
+	responses := map[string]string{
+		"newline": "true\n",
+		"upper":   " TRUE ",
+		"false":   "False\n",
+		"invalid": "yes",
+	}
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, response := range responses {
+			hash := common.BytesToEncryptedPayloadHash([]byte(name))
+			if r.URL.Path == "/transaction/"+hash.ToBase64()+"/isSender" {
+				w.Write([]byte(response))
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{"newline": true, "upper": true, "false": false} {
+		isSender, err := c.IsSender(context.Background(), common.BytesToEncryptedPayloadHash([]byte(name)))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if isSender != want {
+			t.Fatalf("%s: got %t, want %t", name, isSender, want)
+		}
+	}
+	if _, err := c.IsSender(context.Background(), common.BytesToEncryptedPayloadHash([]byte("invalid"))); err == nil {
+		t.Fatal("expected error for unrecognised response")
+	}
+}
+
+func TestGetParticipants(t *testing.T) {
+	alice := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, publicKeyLength))
+	bob := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, publicKeyLength))
+	responses := map[string]string{
+		"two":     alice + "," + bob,
+		"none":    "",
+		"invalid": alice + ",bogus",
+	}
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, response := range responses {
+			hash := common.BytesToEncryptedPayloadHash([]byte(name))
+			if r.URL.Path == "/transaction/"+hash.ToBase64()+"/participants" {
+				w.Write([]byte(response))
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	participants, err := c.GetParticipants(context.Background(), common.BytesToEncryptedPayloadHash([]byte("two")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []PublicKey{PublicKey(alice), PublicKey(bob)}; !reflect.DeepEqual(participants, want) {
+		t.Fatalf("got participants %v, want %v", participants, want)
+	}
+	participants, err = c.GetParticipants(context.Background(), common.BytesToEncryptedPayloadHash([]byte("none")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if participants == nil || len(participants) != 0 {
+		t.Fatalf("got participants %#v, want empty slice", participants)
+	}
+	if _, err := c.GetParticipants(context.Background(), common.BytesToEncryptedPayloadHash([]byte("invalid"))); err == nil {
+		t.Fatal("expected error for invalid participant key")
+	}
+}
+
+func TestSignedPayloadCheck(t *testing.T) {
+	var sent int32
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&sent, 1)
+		w.Write([]byte(testPayloadHash.ToBase64()))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath, WithSignedPayloadCheck())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range [][]byte{[]byte("signed"), make([]byte, 64), append(testPayloadHash.Bytes(), 0)} {
+		if _, err := c.SendSignedPayload(context.Background(), bad, []string{testRecipient}); err == nil {
+			t.Fatalf("expected error for signed payload %x", bad)
+		}
+	}
+	if n := atomic.LoadInt32(&sent); n != 0 {
+		t.Fatalf("%d malformed payloads sent", n)
+	}
+	if _, err := c.SendSignedPayload(context.Background(), testPayloadHash.Bytes(), []string{testRecipient}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the check, payloads go to the privacy manager as they are.
+	c, err = NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SendSignedPayload(context.Background(), []byte("signed"), []string{testRecipient}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReceivePayloadVerbatim(t *testing.T) {
+	body := []byte(testPayloadHash.ToBase64())
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl, err := c.ReceivePayload(context.Background(), []byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pl, body) {
+		t.Fatalf("got payload %q, want the body %q verbatim", pl, body)
+	}
+}
+
+func TestReceivePayloadNotFound(t *testing.T) {
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("c11n-key") == "Ym9vbQ==" {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "Message with hash not found", http.StatusNotFound)
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ReceivePayload(context.Background(), []byte("unknown")); err != ErrPayloadNotFound {
+		t.Fatalf("got error %v, want %v", err, ErrPayloadNotFound)
+	}
+	if _, _, err := c.ReceivePayloadWithMeta(context.Background(), []byte("unknown")); err != ErrPayloadNotFound {
+		t.Fatalf("got error %v with meta, want %v", err, ErrPayloadNotFound)
+	}
+	if _, err := c.ReceivePayloadStream(context.Background(), []byte("unknown")); err != ErrPayloadNotFound {
+		t.Fatalf("got error %v streaming, want %v", err, ErrPayloadNotFound)
+	}
+	// Other failures are still reported as such.
+	_, err = c.ReceivePayload(context.Background(), []byte("boom"))
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusInternalServerError {
+		t.Fatalf("got error %v, want status 500", err)
+	}
+}
+
+func TestReceivePayloadFor(t *testing.T) {
+	var calls int32
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte("for " + r.Header.Get("c11n-to")))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath, WithPayloadCache(10, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, bob := testKey(1), testKey(2)
+	for i := 0; i < 2; i++ {
+		for _, to := range []string{alice, bob, ""} {
+			pl, err := c.ReceivePayloadFor(context.Background(), []byte("key"), to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "for " + to; string(pl) != want {
+				t.Fatalf("got payload %q, want %q", pl, want)
+			}
+		}
+	}
+	if calls != 3 {
+		t.Fatalf("got %d receives, want 3 with payloads cached per recipient", calls)
+	}
+	if _, err := c.ReceivePayloadFor(context.Background(), []byte("key"), "not base64!"); err == nil {
+		t.Fatal("expected error for invalid recipient")
+	}
+}
+
+func TestReceivePayloadWithMeta(t *testing.T) {
+	sender := testKey(7)
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("c11n-key") {
+		case base64.StdEncoding.EncodeToString([]byte("meta")):
+			w.Header().Set("c11n-from", sender)
+			w.Header().Set("c11n-privacy-group-id", "group")
+			w.Header().Set("c11n-privacy-flag", "3")
+		case base64.StdEncoding.EncodeToString([]byte("invalid")):
+			w.Header().Set("c11n-privacy-flag", "many")
+		}
+		w.Write([]byte("payload"))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl, meta, err := c.ReceivePayloadWithMeta(context.Background(), []byte("meta"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ReceiveMeta{Sender: PublicKey(sender), PrivacyGroupID: "group", PrivacyFlag: PrivacyFlagStateValidation}
+	if string(pl) != "payload" || !reflect.DeepEqual(meta, want) {
+		t.Fatalf("got payload %q with %+v, want %q with %+v", pl, meta, "payload", want)
+	}
+	_, meta, err = c.ReceivePayloadWithMeta(context.Background(), []byte("plain"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(meta, &ReceiveMeta{}) {
+		t.Fatalf("got %+v without receive details", meta)
+	}
+	if _, _, err := c.ReceivePayloadWithMeta(context.Background(), []byte("invalid")); err == nil {
+		t.Fatal("expected error for invalid privacy flag")
+	}
+}
+
+func TestPayloadStreaming(t *testing.T) {
+	payload := strings.Repeat("payload", 10000)
+	var received string
+	var contentLength int64
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sendraw":
+			pl, _ := ioutil.ReadAll(r.Body)
+			received, contentLength = string(pl), r.ContentLength
+			w.Write([]byte(testPayloadHash.ToBase64()))
+		case "/receiveraw":
+			w.Write([]byte(payload))
+		}
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := c.SendPayloadReader(context.Background(), strings.NewReader(payload), int64(len(payload)), "", []string{testRecipient})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != testPayloadHash || received != payload || contentLength != int64(len(payload)) {
+		t.Fatalf("got hash %x, %d of %d payload bytes received", hash, len(received), contentLength)
+	}
+	body, err := c.ReceivePayloadStream(context.Background(), hash.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	pl, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(pl) != payload {
+		t.Fatalf("got %d payload bytes, want %d", len(pl), len(payload))
+	}
+}
+
+func TestReceivePayloadStreamClose(t *testing.T) {
+	done := make(chan struct{})
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("payload", 1000)))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		close(done)
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath, WithRequestTimeout(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := c.ReceivePayloadStream(context.Background(), []byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := body.Read(make([]byte, 7)); err != nil {
+		t.Fatal(err)
+	}
+	if err := body.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("closing a partly read stream did not end the request")
+	}
+}
+
+func TestConnectionPoolOptions(t *testing.T) {
+	var conns connCounter
+	release := make(chan struct{})
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("0.10.2"))
+	}))
+	srv.Config.ConnState = conns.track
+	socketPath, shutdown := startTestServer(t, srv)
+	defer shutdown()
+
+	c, err := NewClient(socketPath, WithMaxIdleConns(0, 4), WithIdleConnTimeout(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Four concurrent requests open four connections, all of which stay
+	// pooled for the next round.
+	for round := 0; round < 2; round++ {
+		errc := make(chan error, 4)
+		for i := 0; i < 4; i++ {
+			go func() {
+				_, err := c.GetVersion(context.Background())
+				errc <- err
+			}()
+		}
+		for conns.count() < 4 && round == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		for i := 0; i < 4; i++ {
+			release <- struct{}{}
+		}
+		for i := 0; i < 4; i++ {
+			if err := <-errc; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if n := conns.count(); n != 4 {
+		t.Fatalf("requests used %d connections, want 4", n)
+	}
+}
+
+func TestClose(t *testing.T) {
+	closed := make(chan struct{})
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("0.10.2"))
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			close(closed)
+		}
+	}
+	socketPath, shutdown := startTestServer(t, srv)
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetVersion(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("idle connection not closed")
+	}
+}
+
+func TestCloseCancelsRequests(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer shutdown()
+	defer close(release)
+
+	c, err := NewClient(socketPath, WithRequestTimeout(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := c.GetVersion(context.Background())
+		done <- err
+	}()
+	<-started
+	c.Close()
+	select {
+	case err := <-done:
+		if err != ErrClientClosed {
+			t.Fatalf("got error %v for interrupted call, want %v", err, ErrClientClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not cancel the request in progress")
+	}
+	if _, err := c.GetVersion(context.Background()); err != ErrClientClosed {
+		t.Fatalf("got error %v after Close, want %v", err, ErrClientClosed)
+	}
+}
+
+func TestSetSocketPath(t *testing.T) {
+	versionServer := func(version string) (string, func()) {
+		return newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(version))
+		}))
+	}
+	oldPath, shutdownOld := versionServer("old")
+	defer shutdownOld()
+	newPath, shutdownNew := versionServer("new")
+	defer shutdownNew()
+
+	c, err := NewClient(oldPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(want string) {
+		t.Helper()
+		version, err := c.GetVersion(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version != want {
+			t.Fatalf("got version %q, want %q", version, want)
+		}
+	}
+	check("old")
+	if err := c.SetSocketPath(filepath.Join(filepath.Dir(newPath), "missing.ipc")); err == nil {
+		t.Fatal("expected error for missing socket")
+	}
+	check("old")
+	if err := c.SetSocketPath(newPath); err != nil {
+		t.Fatal(err)
+	}
+	check("new")
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err = NewClientFromURL("http://127.0.0.1:9080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetSocketPath(newPath); err == nil {
+		t.Fatal("expected error for TCP client")
+	}
+}
+
+// roundTripperFunc adapts a function to http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestWithRoundTripper(t *testing.T) {
+	var auth string
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Write([]byte("0.10.2"))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath, WithRoundTripper(func(next http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			req.Header.Set("Authorization", "Bearer token")
+			return next.RoundTrip(req)
+		})
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetVersion(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if auth != "Bearer token" {
+		t.Fatalf("got authorization %q, want %q", auth, "Bearer token")
+	}
+
+	fixture, err := NewClientFromURL("http://ptm.invalid", WithRoundTripper(func(http.RoundTripper) http.RoundTripper {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(strings.NewReader("fixture")),
+				Request:    req,
+			}, nil
+		})
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, err := fixture.GetVersion(context.Background()); err != nil || version != "fixture" {
+		t.Fatalf("got version %q, %v from fixture", version, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	socketPath, shutdown := newTestServer(t, http.NotFoundHandler())
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(filepath.Dir(socketPath), "missing.ipc")
+	if c, _ = NewClient(missing); c.Validate() == nil || !strings.Contains(c.Validate().Error(), missing) {
+		t.Fatalf("got error %v for missing socket", c.Validate())
+	}
+	if c, _ = NewClient(filepath.Dir(socketPath)); c.Validate() == nil {
+		t.Fatal("expected error for directory instead of socket")
+	}
+	if c, _ = NewClientFromURL("http://127.0.0.1:9080"); c.Validate() != nil {
+		t.Fatalf("got error %v for TCP client", c.Validate())
+	}
+}
+
+func TestValidateSocketPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix permission bits are not kept on Windows")
+	}
+	socketPath, shutdown := newTestServer(t, http.NotFoundHandler())
+	defer shutdown()
+
+	warnings := func(perm os.FileMode, opts ...Option) (int, error) {
+		t.Helper()
+		if err := os.Chmod(socketPath, perm); err != nil {
+			t.Fatal(err)
+		}
+		logger, records := recordingLogger()
+		c, err := NewClient(socketPath, append(opts, WithLogger(logger))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.Validate()
+		n := 0
+		for _, r := range records() {
+			if r.Lvl == log.LvlWarn {
+				n++
+			}
+		}
+		return n, err
+	}
+	if n, err := warnings(0700); n != 0 || err != nil {
+		t.Fatalf("got %d warnings, error %v for private socket", n, err)
+	}
+	if n, err := warnings(0755, WithStrictSocketPermissions()); n != 0 || err != nil {
+		t.Fatalf("got %d warnings, error %v for world-readable socket", n, err)
+	}
+	if n, err := warnings(0777); n != 1 || err != nil {
+		t.Fatalf("got %d warnings, error %v for world-writable socket, want a warning", n, err)
+	}
+	if _, err := warnings(0777, WithStrictSocketPermissions()); err == nil || !strings.Contains(err.Error(), socketPath) {
+		t.Fatalf("got error %v for world-writable socket in strict mode", err)
+	}
+}
+
+func TestAbstractSocket(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("abstract sockets are only supported on Linux")
+	}
+	socketPath := fmt.Sprintf("@ptm-test-%d", os.Getpid())
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("0.10.2"))
+	}))
+	srv.Listener = l
+	srv.Start()
+	defer srv.Close()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetVersion(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if c, _ = NewClient(socketPath + "-missing"); c.Validate() == nil {
+		t.Fatal("expected error for missing abstract socket")
+	}
+}
+
+func TestNamedPipeUnsupported(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("named pipes are supported on Windows")
+	}
+	c, err := NewClient(`\\.\pipe\tessera`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetVersion(context.Background()); err == nil || !strings.Contains(err.Error(), "only supported on Windows") {
+		t.Fatalf("got error %v, want named pipes to be unsupported", err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("0.10.2"))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath, WithRateLimit(50, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 0; i < 7; i++ {
+		if _, err := c.GetVersion(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The burst covers two requests, the other five wait 20ms each.
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Fatalf("7 requests took %v, want rate limiting to slow them down", elapsed)
+	}
+
+	c, err = NewClient(socketPath, WithRateLimit(0.1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetVersion(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.GetVersion(ctx); err == nil {
+		t.Fatal("expected rate limited request to fail at the context deadline")
+	}
+}
+
+func TestMaxInFlight(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.Write([]byte("0.10.2"))
+	}))
+	defer shutdown()
+
+	for _, wait := range []bool{false, true} {
+		c, err := NewClient(socketPath, WithMaxInFlight(1, wait))
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error)
+		go func() {
+			_, err := c.GetVersion(context.Background())
+			done <- err
+		}()
+		<-started
+		if n := c.InFlight(); n != 1 {
+			t.Fatalf("got %d requests in flight, want 1", n)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err = c.GetVersion(ctx)
+		cancel()
+		want := ErrConcurrencyLimit
+		if wait {
+			want = context.DeadlineExceeded
+		}
+		if err != want {
+			t.Fatalf("got error %v with wait %v, want %v", err, wait, want)
+		}
+
+		release <- struct{}{}
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		if n := c.InFlight(); n != 0 {
+			t.Fatalf("got %d requests in flight after completion, want 0", n)
+		}
+	}
+}
+
+func TestMaxPayloadSize(t *testing.T) {
+	var calls int32
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		ioutil.ReadAll(r.Body)
+		w.Write([]byte(testPayloadHash.ToBase64()))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath, WithMaxPayloadSize(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SendPayload(context.Background(), []byte("four"), "", []string{testRecipient}); err != nil {
+		t.Fatal(err)
+	}
+	var sizeErr *PayloadTooLargeError
+	if _, err := c.SendPayload(context.Background(), []byte("five!"), "", []string{testRecipient}); !errors.As(err, &sizeErr) || sizeErr.Size != 5 {
+		t.Fatalf("got error %v, want payload too large", err)
+	}
+	if _, err := c.StorePayload(context.Background(), []byte("five!"), ""); !errors.As(err, &sizeErr) {
+		t.Fatalf("got error %v, want payload too large", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("privacy manager received %d requests, want 1", n)
+	}
+
+	stream := ioutil.NopCloser(strings.NewReader("five!"))
+	if _, err := c.SendPayloadReader(context.Background(), stream, -1, "", []string{testRecipient}); !errors.As(err, &sizeErr) || sizeErr.Size != -1 {
+		t.Fatalf("got error %v, want payload too large", err)
+	}
+	stream = ioutil.NopCloser(strings.NewReader("four"))
+	if _, err := c.SendPayloadReader(context.Background(), stream, -1, "", []string{testRecipient}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPayloadVerification(t *testing.T) {
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pl, err := c.ReceivePayload(context.Background(), []byte("key")); err != nil || len(pl) != 0 {
+		t.Fatalf("got payload %q, error %v without verification", pl, err)
+	}
+	c, err = NewClient(socketPath, WithPayloadVerification())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ReceivePayload(context.Background(), []byte("key")); err != ErrEmptyPayload {
+		t.Fatalf("got error %v, want %v", err, ErrEmptyPayload)
+	}
+}
@@ -0,0 +1,422 @@
+package privatetransactionmanager
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/opentracing/opentracing-go"
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultDialTimeout           = 1 * time.Second
+	defaultRequestTimeout        = 5 * time.Second
+	defaultResponseHeaderTimeout = 5 * time.Second
+)
+
+// clientConfig collects the settings applied by Options when a Client is built.
+type clientConfig struct {
+	dialTimeout           time.Duration
+	requestTimeout        time.Duration
+	responseHeaderTimeout time.Duration
+	tlsConfig             *tls.Config
+	retry                 retryConfig
+	metrics               metrics.Registry
+	logger                log.Logger
+	tracer                opentracing.Tracer
+	batchConcurrency      int
+	compression           bool
+	payloadCacheEntries   int
+	payloadCacheBytes     int
+	txInfoCacheTTL        time.Duration
+	txInfoCacheEntries    int
+	maxIdleConns          int
+	maxIdleConnsPerHost   int
+	idleConnTimeout       time.Duration
+	rateLimit             rate.Limit
+	rateBurst             int
+	maxPayloadSize        int64
+	verifyPayloads        bool
+	wrapTransport         func(http.RoundTripper) http.RoundTripper
+	defaultSender         string
+	maxInFlight           int
+	api                   API
+	expvarName            string
+	checkSignedPayloads   bool
+	repeatRecipients      bool
+	dedupTTL              time.Duration
+	restartWait           time.Duration
+	waitForSlot           bool
+	dumpRequests          bool
+	dumpKeys              bool
+	http2                 bool
+	strictSocketPerms     bool
+}
+
+func newClientConfig(opts []Option) *clientConfig {
+	cfg := &clientConfig{
+		dialTimeout:           defaultDialTimeout,
+		requestTimeout:        defaultRequestTimeout,
+		responseHeaderTimeout: defaultResponseHeaderTimeout,
+		logger:                log.Root(),
+		batchConcurrency:      defaultBatchConcurrency,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// Option customises a Client created by NewClient.
+type Option func(*clientConfig)
+
+// wrap returns the round tripper the client sends its requests through, given
+// its own transport.
+func (cfg *clientConfig) wrap(transport http.RoundTripper) http.RoundTripper {
+	if cfg.dumpRequests {
+		transport = &dumpTransport{next: transport, logger: cfg.logger, unsafe: cfg.dumpKeys}
+	}
+	if cfg.wrapTransport != nil {
+		transport = cfg.wrapTransport(transport)
+	}
+	return transport
+}
+
+// WithDialTimeout sets how long to wait when connecting to the privacy manager.
+func WithDialTimeout(d time.Duration) Option {
+	return func(cfg *clientConfig) {
+		cfg.dialTimeout = d
+	}
+}
+
+// WithRequestTimeout sets the time limit for each attempt of a request,
+// including reading the response body; it defaults to 5 seconds and zero means
+// no limit. A call whose context has an earlier deadline ends at that deadline
+// instead, while WithCallTimeout replaces the limit for individual calls,
+// allowing them to take longer.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(cfg *clientConfig) {
+		cfg.requestTimeout = d
+	}
+}
+
+// WithResponseHeaderTimeout sets how long to wait for the privacy manager's
+// response headers once the request has been written.
+func WithResponseHeaderTimeout(d time.Duration) Option {
+	return func(cfg *clientConfig) {
+		cfg.responseHeaderTimeout = d
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used for https:// privacy manager
+// URLs, e.g. one built by NewTLSConfig for mutual TLS, or by
+// NewReloadingTLSConfig for client certificates that are rotated while the
+// client is in use. It has no effect on unix socket clients.
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(cfg *clientConfig) {
+		cfg.tlsConfig = tlsConfig
+	}
+}
+
+// WithRetry retries failed requests up to maxAttempts times in total, waiting
+// an exponentially growing, jittered delay starting at baseDelay between
+// attempts, or retrying at once if baseDelay is zero. Sends are only retried
+// if the request never reached the privacy manager.
+func WithRetry(maxAttempts int, baseDelay time.Duration) Option {
+	return func(cfg *clientConfig) {
+		cfg.retry.maxAttempts = maxAttempts
+		cfg.retry.baseDelay = baseDelay
+	}
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy in deciding which failures are
+// retried. It only takes effect together with WithRetry.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(cfg *clientConfig) {
+		cfg.retry.policy = policy
+	}
+}
+
+// WithMetrics records request counts, latencies and traffic in registry, or in
+// metrics.DefaultRegistry if it is nil, from where they are exported along
+// with geth's other metrics, e.g. to Prometheus. As with all geth metrics,
+// nothing is collected unless metrics collection is enabled.
+func WithMetrics(registry metrics.Registry) Option {
+	return func(cfg *clientConfig) {
+		if registry == nil {
+			registry = metrics.DefaultRegistry
+		}
+		cfg.metrics = registry
+	}
+}
+
+// WithLogger sets the logger receiving a line for every privacy manager
+// request, with its operation, duration and status. Failed requests are
+// logged with the payload hash they concern, but never with payload data.
+// By default the root logger is used.
+func WithLogger(logger log.Logger) Option {
+	return func(cfg *clientConfig) {
+		cfg.logger = logger
+	}
+}
+
+// WithTracer creates a span for every privacy manager request with tracer,
+// tagged with the operation, payload size, recipient count and response
+// status. Spans are children of the span found in the call's context, if any.
+// Without a tracer no spans are created.
+func WithTracer(tracer opentracing.Tracer) Option {
+	return func(cfg *clientConfig) {
+		cfg.tracer = tracer
+	}
+}
+
+// WithBatchConcurrency limits how many requests a batch call such as
+// SendPayloadBatch or ReceivePayloadBatch keeps in flight at once. The default is 4.
+func WithBatchConcurrency(n int) Option {
+	return func(cfg *clientConfig) {
+		if n < 1 {
+			n = 1
+		}
+		cfg.batchConcurrency = n
+	}
+}
+
+// WithCompression gzip compresses the payloads sent to the privacy manager and
+// asks it to compress its responses, which are decompressed transparently.
+// The privacy manager must accept compressed requests; it may answer
+// uncompressed.
+func WithCompression() Option {
+	return func(cfg *clientConfig) {
+		cfg.compression = true
+	}
+}
+
+// WithPayloadCache caches up to maxEntries payloads of at most maxBytes total
+// size retrieved by ReceivePayload, so that repeated requests for the same
+// payload skip the privacy manager. A limit of zero means no limit, but at
+// least one must be set to enable the cache.
+func WithPayloadCache(maxEntries, maxBytes int) Option {
+	return func(cfg *clientConfig) {
+		cfg.payloadCacheEntries = maxEntries
+		cfg.payloadCacheBytes = maxBytes
+	}
+}
+
+// WithTxInfoCache caches up to maxEntries answers of IsSender and
+// GetParticipants for ttl, so that validating many private transactions
+// doesn't query the privacy manager for the same payload again and again. A
+// limit of zero means 10000 answers.
+func WithTxInfoCache(ttl time.Duration, maxEntries int) Option {
+	return func(cfg *clientConfig) {
+		cfg.txInfoCacheTTL = ttl
+		cfg.txInfoCacheEntries = maxEntries
+	}
+}
+
+// WithMaxIdleConns limits the number of idle connections kept open to the
+// privacy manager in total and per host. Zero means no limit in total and
+// http.DefaultMaxIdleConnsPerHost (2) per host, the defaults of http.Transport.
+func WithMaxIdleConns(total, perHost int) Option {
+	return func(cfg *clientConfig) {
+		cfg.maxIdleConns = total
+		cfg.maxIdleConnsPerHost = perHost
+	}
+}
+
+// WithIdleConnTimeout closes connections that have been idle for d. Zero, the
+// default, keeps them open indefinitely.
+func WithIdleConnTimeout(d time.Duration) Option {
+	return func(cfg *clientConfig) {
+		cfg.idleConnTimeout = d
+	}
+}
+
+// WithRateLimit limits the requests sent to the privacy manager to
+// requestsPerSecond on average, allowing bursts of up to burst requests.
+// Retries count as requests. A request waiting for the limiter gives up when
+// its context is done.
+func WithRateLimit(requestsPerSecond float64, burst int) Option {
+	return func(cfg *clientConfig) {
+		if burst < 1 {
+			burst = 1
+		}
+		cfg.rateLimit = rate.Limit(requestsPerSecond)
+		cfg.rateBurst = burst
+	}
+}
+
+// WithMaxPayloadSize rejects payloads larger than size bytes with a
+// *PayloadTooLargeError instead of sending them to the privacy manager.
+func WithMaxPayloadSize(size int64) Option {
+	return func(cfg *clientConfig) {
+		cfg.maxPayloadSize = size
+	}
+}
+
+// WithPayloadVerification makes ReceivePayload fail with ErrEmptyPayload when
+// the privacy manager answers a request for a payload with an empty body.
+// The payload can't be checked against its hash, which is computed over the
+// encrypted payload; only the privacy manager holds the ciphertext.
+func WithPayloadVerification() Option {
+	return func(cfg *clientConfig) {
+		cfg.verifyPayloads = true
+	}
+}
+
+// WithRoundTripper wraps the transport the client sends its requests through,
+// e.g. to add authentication headers, record requests or replace the privacy
+// manager with a test fixture. wrap is called once with the client's own
+// transport, which it may ignore, and again if SetSocketPath replaces it; the
+// returned one is used for all requests. It sees every attempt of a retried
+// request, with compression already applied.
+func WithRoundTripper(wrap func(next http.RoundTripper) http.RoundTripper) Option {
+	return func(cfg *clientConfig) {
+		cfg.wrapTransport = wrap
+	}
+}
+
+// WithDefaultSender sends and stores payloads on behalf of the base64 encoded
+// key b64From whenever a call leaves its sender empty, instead of the privacy
+// manager's default key. A sender given to a call still takes precedence.
+func WithDefaultSender(b64From string) Option {
+	return func(cfg *clientConfig) {
+		cfg.defaultSender = b64From
+	}
+}
+
+// WithMaxInFlight limits the requests the client has in progress at once to n,
+// across all operations, so that bursts don't pile up on the privacy manager's
+// socket. A request's slot is held until its response has been read, over all
+// its attempts. If wait is true, calls beyond the limit wait for a slot until
+// their context is done; otherwise they fail right away with
+// ErrConcurrencyLimit.
+func WithMaxInFlight(n int, wait bool) Option {
+	return func(cfg *clientConfig) {
+		cfg.maxInFlight = n
+		cfg.waitForSlot = wait
+	}
+}
+
+// WithAPI selects the endpoints SendPayload, SendPayloadWithFlag,
+// SendPayloadWithOptions, ReceivePayload, ReceivePayloadFor and
+// ReceivePayloadWithMeta use, for privacy managers exposing only one of the
+// raw and JSON APIs. The default is RawAPI. Streaming calls always use the raw
+// API.
+func WithAPI(api API) Option {
+	return func(cfg *clientConfig) {
+		cfg.api = api
+	}
+}
+
+// WithExpvar publishes counters of the client's requests, failed requests and
+// bytes sent and received through expvar, as a map named name that shows up
+// on /debug/vars. Each client should be given a name of its own; clients
+// sharing a name add to the same counters. Creating the client fails if the
+// name is taken by another variable, such as "memstats".
+func WithExpvar(name string) Option {
+	return func(cfg *clientConfig) {
+		cfg.expvarName = name
+	}
+}
+
+// WithSignedPayloadCheck makes SendSignedPayload check locally that the payload
+// has the form of a hash returned by StorePayload, so that a caller passing
+// the wrong bytes gets a precise error instead of the privacy manager's
+// rejection.
+func WithSignedPayloadCheck() Option {
+	return func(cfg *clientConfig) {
+		cfg.checkSignedPayloads = true
+	}
+}
+
+// WithRepeatedRecipientHeaders sends the recipients of a send as one c11n-to
+// header per key instead of a single comma separated header, for privacy
+// manager versions that expect them that way.
+func WithRepeatedRecipientHeaders() Option {
+	return func(cfg *clientConfig) {
+		cfg.repeatRecipients = true
+	}
+}
+
+// WithSendDeduplication makes the client distribute a payload only once per
+// idempotency key set with WithIdempotencyKey. A send with the key of a send
+// that succeeded within ttl returns the earlier result without contacting the
+// privacy manager, and one made while a send with the same key is in progress
+// waits for it and shares its result, success or failure. Failed sends are
+// not remembered, so a send that reached the privacy manager but whose
+// acknowledgement was lost may still be distributed again by a later attempt:
+// neither Constellation nor Tessera deduplicates sends. Deduplication is
+// local to the client and covers the calls built on SendPayloadWithOptions
+// and SendPayloadResult.
+func WithSendDeduplication(ttl time.Duration) Option {
+	return func(cfg *clientConfig) {
+		cfg.dedupTTL = ttl
+	}
+}
+
+// WithRestartWait lets calls ride out a restart of the privacy manager, such
+// as one by a Supervisor: while connections are refused or the socket is
+// missing, the connection is retried every 50ms for up to wait, or until the
+// call's context is done, before the call fails.
+func WithRestartWait(wait time.Duration) Option {
+	return func(cfg *clientConfig) {
+		cfg.restartWait = wait
+	}
+}
+
+// WithFailFastOnRefused makes calls to a privacy manager that refuses
+// connections or whose socket is missing fail right away, without the
+// retries and backoff WithRetry would otherwise apply. Connections are still
+// retried for as long as WithRestartWait allows.
+func WithFailFastOnRefused() Option {
+	return func(cfg *clientConfig) {
+		cfg.retry.failFastRefused = true
+	}
+}
+
+// WithRequestDump logs the request line and headers of every request sent to
+// the privacy manager, and the status and headers of its response, at info
+// level, for diagnosing interoperability problems. Bodies are not logged, and
+// the values of headers and query parameters carrying keys, such as c11n-from,
+// c11n-to and c11n-key, are redacted. Requests are dumped as they are handed
+// to the client's own transport, i.e. including the changes made by a
+// WithRoundTripper wrapper and once per attempt.
+func WithRequestDump() Option {
+	return func(cfg *clientConfig) {
+		cfg.dumpRequests = true
+	}
+}
+
+// WithUnsafeRequestDump is like WithRequestDump but logs keys unredacted. It
+// is meant for local debugging only: the logs reveal who transacts with whom.
+func WithUnsafeRequestDump() Option {
+	return func(cfg *clientConfig) {
+		cfg.dumpRequests = true
+		cfg.dumpKeys = true
+	}
+}
+
+// WithHTTP2 lets clients created by NewClientFromURL use HTTP/2 with https://
+// privacy managers that support it, so that concurrent calls share a single
+// connection instead of opening one each. HTTP/2 is negotiated during the TLS
+// handshake, so http:// URLs, and servers without HTTP/2, keep using HTTP/1.1.
+// The option is ignored by unix socket clients.
+func WithHTTP2() Option {
+	return func(cfg *clientConfig) {
+		cfg.http2 = true
+	}
+}
+
+// WithStrictSocketPermissions makes Validate and SetSocketPath reject a
+// privacy manager socket that all users of the host may write to, and thus
+// connect to and have payloads decrypted through, instead of only logging a
+// warning. Sockets only readable by all users are accepted, as reading a
+// socket file doesn't allow connecting to it.
+func WithStrictSocketPermissions() Option {
+	return func(cfg *clientConfig) {
+		cfg.strictSocketPerms = true
+	}
+}
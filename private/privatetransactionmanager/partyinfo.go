@@ -0,0 +1,50 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// PartyInfo is the privacy manager's view of the network: the peers it knows
+// and the public keys reachable through them.
+type PartyInfo struct {
+	URL   string      `json:"url"` // advertised URL of the local node
+	Peers []PartyPeer `json:"peers"`
+	Keys  []PartyKey  `json:"keys"`
+}
+
+// PartyPeer is a privacy manager node known to the local node.
+type PartyPeer struct {
+	URL         string `json:"url"`
+	LastContact string `json:"lastContact,omitempty"`
+}
+
+// PartyKey maps a public key to the URL of the node hosting it.
+type PartyKey struct {
+	Key string `json:"key"`
+	URL string `json:"url"`
+}
+
+// GetPartyInfo retrieves the party information of the privacy manager, which
+// shows whether a recipient's key is known and where it is expected to be
+// reachable. The response is parsed in Tessera's JSON format; Constellation
+// only exchanges party information in its binary peer-to-peer encoding and
+// is not supported.
+func (c *Client) GetPartyInfo(ctx context.Context) (*PartyInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.requestURL("partyinfo"), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.do(opPartyInfo, req)
+	if err != nil {
+		return nil, err
+	}
+	defer drainAndClose(res)
+
+	info := new(PartyInfo)
+	if err := json.NewDecoder(res.Body).Decode(info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
@@ -0,0 +1,36 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestGetPartyInfo(t *testing.T) {
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+			"url": "http://127.0.0.1:9001/",
+			"peers": [{"url": "http://127.0.0.1:9002/", "lastContact": "2019-11-05T10:15:30Z"}],
+			"keys": [{"key": "QfeDAys9MPDs2XHExtc84jKGHxZg/aj52DTh0vtA3Xc=", "url": "http://127.0.0.1:9002/"}]
+		}`))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := c.GetPartyInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &PartyInfo{
+		URL:   "http://127.0.0.1:9001/",
+		Peers: []PartyPeer{{URL: "http://127.0.0.1:9002/", LastContact: "2019-11-05T10:15:30Z"}},
+		Keys:  []PartyKey{{Key: "QfeDAys9MPDs2XHExtc84jKGHxZg/aj52DTh0vtA3Xc=", URL: "http://127.0.0.1:9002/"}},
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Fatalf("got party info %+v, want %+v", info, want)
+	}
+}
@@ -0,0 +1,15 @@
+// +build !windows
+
+package privatetransactionmanager
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// dialPipe fails, named pipes only exist on Windows.
+func dialPipe(ctx context.Context, path string, timeout time.Duration) (net.Conn, error) {
+	return nil, &net.OpError{Op: "dial", Net: "pipe", Err: errors.New("named pipes are only supported on Windows")}
+}
@@ -0,0 +1,26 @@
+// +build windows
+
+package privatetransactionmanager
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"gopkg.in/natefinch/npipe.v2"
+)
+
+// dialPipe connects to a named pipe, giving up after timeout or at the
+// context deadline, whichever comes first.
+func dialPipe(ctx context.Context, path string, timeout time.Duration) (net.Conn, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline); left < timeout {
+			timeout = left
+		}
+	}
+	conn, err := npipe.DialTimeout(path, timeout)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: "pipe", Err: err}
+	}
+	return conn, nil
+}
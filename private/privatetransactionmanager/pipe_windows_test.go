@@ -0,0 +1,43 @@
+// +build windows
+
+package privatetransactionmanager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"gopkg.in/natefinch/npipe.v2"
+)
+
+func TestNamedPipe(t *testing.T) {
+	pipePath := fmt.Sprintf(`\\.\pipe\ptm-test-%d`, os.Getpid())
+	l, err := npipe.Listen(pipePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("0.10.2"))
+	}))
+	srv.Listener = l
+	srv.Start()
+	defer srv.Close()
+
+	c, err := NewClient(pipePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	version, err := c.GetVersion(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "0.10.2" {
+		t.Fatalf("got version %q, want %q", version, "0.10.2")
+	}
+}
@@ -0,0 +1,113 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+type createPrivacyGroupReq struct {
+	Addresses   []string `json:"addresses"`
+	From        string   `json:"from"`
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+type deletePrivacyGroupReq struct {
+	PrivacyGroupID string `json:"privacyGroupId"`
+	From           string `json:"from"`
+}
+
+type findPrivacyGroupsReq struct {
+	Addresses []string `json:"addresses"`
+}
+
+// PrivacyGroup is a set of participants that private transactions can be
+// addressed to as a whole.
+type PrivacyGroup struct {
+	ID          string   `json:"privacyGroupId"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Members     []string `json:"members"` // base64 encoded public keys
+	Type        string   `json:"type"`    // e.g. "PANTHEON" or "LEGACY"
+}
+
+// CreatePrivacyGroup creates a privacy group of the given base64 encoded
+// member keys on behalf of b64From and returns the id assigned to it by the
+// privacy manager. Privacy groups are only supported by Tessera.
+func (c *Client) CreatePrivacyGroup(ctx context.Context, b64From string, members []string, name, description string) (string, error) {
+	b64From = c.sender(b64From)
+	if err := validateKeys(b64From, nil); err != nil {
+		return "", err
+	}
+	if err := validateMembers(members); err != nil {
+		return "", err
+	}
+	createReq := &createPrivacyGroupReq{
+		Addresses:   members,
+		From:        b64From,
+		Name:        name,
+		Description: description,
+	}
+	var group PrivacyGroup
+	if err := c.doJson(ctx, opCreatePrivacyGroup, "createPrivacyGroup", createReq, &group); err != nil {
+		return "", err
+	}
+	return group.ID, nil
+}
+
+// FindPrivacyGroups returns the privacy groups whose members are exactly the
+// given base64 encoded keys.
+func (c *Client) FindPrivacyGroups(ctx context.Context, members []string) ([]PrivacyGroup, error) {
+	if err := validateMembers(members); err != nil {
+		return nil, err
+	}
+	var groups []PrivacyGroup
+	if err := c.doJson(ctx, opFindPrivacyGroups, "findPrivacyGroups", &findPrivacyGroupsReq{Addresses: members}, &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// DeletePrivacyGroup deletes the privacy group groupID on behalf of b64From,
+// one of its members. It returns ErrPrivacyGroupNotFound if the privacy
+// manager doesn't know the group.
+func (c *Client) DeletePrivacyGroup(ctx context.Context, b64From, groupID string) error {
+	b64From = c.sender(b64From)
+	if err := validateKeys(b64From, nil); err != nil {
+		return err
+	}
+	if err := validateBase64("privacy group id", groupID); err != nil {
+		return err
+	}
+	deleteReq := &deletePrivacyGroupReq{PrivacyGroupID: groupID, From: b64From}
+	err := c.doJson(ctx, opDeletePrivacyGroup, "deletePrivacyGroup", deleteReq, nil)
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound {
+		return ErrPrivacyGroupNotFound
+	}
+	return err
+}
+
+// validateMembers checks that every member is a valid public key, so that
+// malformed keys are reported before anything is sent to the privacy manager.
+func validateMembers(members []string) error {
+	for _, member := range members {
+		if _, err := ParsePublicKey(member); err != nil {
+			return fmt.Errorf("bad member: %v", err)
+		}
+	}
+	return nil
+}
+
+// validateBase64 checks that value, described by what in the error, is valid
+// standard base64.
+func validateBase64(what, value string) error {
+	if _, err := base64.StdEncoding.DecodeString(value); err != nil {
+		return fmt.Errorf("invalid %s %q: %v", what, value, err)
+	}
+	return nil
+}
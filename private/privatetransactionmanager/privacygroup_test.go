@@ -0,0 +1,131 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCreatePrivacyGroup(t *testing.T) {
+	var got createPrivacyGroupReq
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil || r.URL.Path != "/createPrivacyGroup" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"privacyGroupId":"Z3JvdXA=","name":"name","type":"PANTHEON"}`))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	members := []string{testKey(1), testKey(2)}
+	id, err := c.CreatePrivacyGroup(context.Background(), members[0], members, "name", "description")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "Z3JvdXA=" {
+		t.Fatalf("got group id %q, want %q", id, "Z3JvdXA=")
+	}
+	want := createPrivacyGroupReq{Addresses: members, From: members[0], Name: "name", Description: "description"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got request %+v, want %+v", got, want)
+	}
+}
+
+func TestPrivacyGroupInvalidKeys(t *testing.T) {
+	c, err := NewClient("/nonexistent/tm.ipc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Bad keys are rejected before anything is sent to the privacy manager.
+	check := func(err error, want string) {
+		t.Helper()
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got error %v, want %q", err, want)
+		}
+	}
+	for _, from := range []string{"not base64!", "a2V5MQ=="} {
+		_, err := c.CreatePrivacyGroup(context.Background(), from, []string{testKey(1)}, "", "")
+		check(err, "bad sender")
+		check(c.DeletePrivacyGroup(context.Background(), from, "Z3JvdXA="), "bad sender")
+	}
+	for _, member := range []string{"not base64!", "", "a2V5MQ=="} {
+		_, err := c.CreatePrivacyGroup(context.Background(), testKey(1), []string{testKey(1), member}, "", "")
+		check(err, "bad member")
+		_, err = c.FindPrivacyGroups(context.Background(), []string{member})
+		check(err, "bad member")
+	}
+}
+
+func TestFindPrivacyGroups(t *testing.T) {
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req findPrivacyGroupsReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.URL.Path != "/findPrivacyGroups" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if len(req.Addresses) != 2 {
+			w.Write([]byte(`[]`))
+			return
+		}
+		json.NewEncoder(w).Encode([]PrivacyGroup{{ID: "Z3JvdXA=", Name: "name", Description: "description", Members: req.Addresses, Type: "PANTHEON"}})
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	members := []string{testKey(1), testKey(2)}
+	groups, err := c.FindPrivacyGroups(context.Background(), members)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PrivacyGroup{{ID: "Z3JvdXA=", Name: "name", Description: "description", Members: members, Type: "PANTHEON"}}
+	if !reflect.DeepEqual(groups, want) {
+		t.Fatalf("got groups %+v, want %+v", groups, want)
+	}
+	groups, err = c.FindPrivacyGroups(context.Background(), members[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 0 {
+		t.Fatalf("got groups %+v, want none", groups)
+	}
+}
+
+func TestDeletePrivacyGroup(t *testing.T) {
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req deletePrivacyGroupReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.URL.Path != "/deletePrivacyGroup" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if req.PrivacyGroupID != "Z3JvdXA=" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`"Z3JvdXA="`))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeletePrivacyGroup(context.Background(), testKey(1), "Z3JvdXA="); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeletePrivacyGroup(context.Background(), testKey(1), "b3RoZXI="); err != ErrPrivacyGroupNotFound {
+		t.Fatalf("got error %v, want %v", err, ErrPrivacyGroupNotFound)
+	}
+	if err := c.DeletePrivacyGroup(context.Background(), testKey(1), "not base64!"); err == nil || err == ErrPrivacyGroupNotFound {
+		t.Fatalf("got error %v, want validation error", err)
+	}
+}
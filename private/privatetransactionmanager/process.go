@@ -0,0 +1,425 @@
+package privatetransactionmanager
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// DefaultNodeBinary is the privacy manager executable LaunchNode looks up
+	// on PATH when no binary is given.
+	DefaultNodeBinary = "constellation-node"
+
+	// nodeStopTimeout is how long a node that failed to come up is given to
+	// exit before it is killed.
+	nodeStopTimeout = 5 * time.Second
+
+	// stderrTailLines is the number of lines of a node's standard error kept
+	// for the error reported when it fails to come up.
+	stderrTailLines = 20
+)
+
+// ReadyConfig controls how long and how often a new node's upcheck is polled
+// while waiting for it to come up.
+type ReadyConfig struct {
+	InitialDelay time.Duration // before the first upcheck
+	PollInterval time.Duration // between two upchecks
+	Timeout      time.Duration // overall, including the initial delay; zero means no limit
+}
+
+var (
+	// ConstellationReady suits Constellation, which starts within moments.
+	// It is the default of LaunchNode.
+	ConstellationReady = ReadyConfig{PollInterval: 50 * time.Millisecond, Timeout: 10 * time.Second}
+
+	// TesseraReady suits Tessera, whose JVM takes seconds to start, so
+	// polling it often gains nothing but log noise.
+	TesseraReady = ReadyConfig{InitialDelay: 2 * time.Second, PollInterval: 500 * time.Millisecond, Timeout: time.Minute}
+)
+
+// LaunchOption customises how LaunchNode runs a node.
+type LaunchOption func(*launchConfig)
+
+type launchConfig struct {
+	logger log.Logger
+	env    []string
+	ready  ReadyConfig
+}
+
+// WithNodeLogger sets the logger receiving the node's output, one entry per
+// line, tagged with the node's executable name. Lines written to standard
+// output are logged at info level, those written to standard error as
+// warnings. By default the root logger is used.
+func WithNodeLogger(logger log.Logger) LaunchOption {
+	return func(cfg *launchConfig) {
+		cfg.logger = logger
+	}
+}
+
+// WithNodeEnv adds environment variables in "key=value" form to the
+// environment the node inherits, e.g. JAVA_OPTS for Tessera. Variables given
+// here take precedence over inherited ones of the same name.
+func WithNodeEnv(env ...string) LaunchOption {
+	return func(cfg *launchConfig) {
+		cfg.env = append(cfg.env, env...)
+	}
+}
+
+// WithReadyConfig sets how LaunchNode waits for the node to come up, e.g.
+// TesseraReady for Tessera. The default is ConstellationReady.
+func WithReadyConfig(ready ReadyConfig) LaunchOption {
+	return func(cfg *launchConfig) {
+		cfg.ready = ready
+	}
+}
+
+// LaunchNode starts the privacy manager executable binaryPath with the given
+// configuration file and waits until it answers on the socket configured
+// there. binaryPath may be an absolute path, e.g. to a pinned version or a
+// Tessera wrapper script, or empty to run DefaultNodeBinary from PATH. The
+// configuration, a Constellation TOML or Tessera JSON file, is checked with
+// ValidateConfig before the node is started. If the node exits before it is
+// ready, LaunchNode returns right away with its exit status. Nodes started by
+// LaunchNode are waited for in the background, so cmd.Wait fails: use StopNode
+// or a Supervisor to stop them and learn how they exited. A node that was
+// stopped otherwise, e.g. by killing cmd.Process, has cmd.ProcessState set once
+// it has been reaped.
+func LaunchNode(binaryPath, cfgPath string, opts ...LaunchOption) (*exec.Cmd, error) {
+	if binaryPath == "" {
+		binaryPath = DefaultNodeBinary
+	}
+	lcfg := &launchConfig{logger: log.Root(), ready: ConstellationReady}
+	for _, opt := range opts {
+		opt(lcfg)
+	}
+	cfg, err := loadValidConfig(cfgPath)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(binaryPath, cfgPath)
+	if len(lcfg.env) > 0 {
+		// When a variable is set more than once, the last value wins.
+		cmd.Env = append(os.Environ(), lcfg.env...)
+	}
+	// The output is copied by goroutines of exec, which Wait waits for and
+	// reports the errors of, so that they end together with the node. Nodes
+	// run through a wrapper script should exec the node, or children left
+	// holding the output open keep Wait from returning.
+	logger := lcfg.logger.New("node", filepath.Base(binaryPath))
+	stderr := &lineLogger{logf: logger.Warn, tail: make([]string, 0, stderrTailLines)}
+	cmd.Stdout = &lineLogger{logf: logger.Info}
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	exit := watchNode(cmd)
+
+	// Stop waiting as soon as the node exits, e.g. on a bad configuration.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-exit.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	if err := WaitForNodeReadyContext(ctx, cfg.SocketFile(), lcfg.ready); err != nil {
+		select {
+		case <-exit.done:
+			// Waiting for the node has also copied its output in full.
+			err = &exitedError{exit.err}
+		default:
+			// Stopping the node waits for its output to be copied in full.
+			StopNode(cmd, nodeStopTimeout)
+		}
+		return nil, &LaunchError{Err: err, Stderr: stderr.lastLines()}
+	}
+	return cmd, nil
+}
+
+// exitedError reports a node that exited before it was ready, wrapping the
+// result of waiting for it, such as an *exec.ExitError.
+type exitedError struct {
+	err error
+}
+
+func (e *exitedError) Error() string {
+	if e.err == nil {
+		return "privacy manager exited before it was ready"
+	}
+	return fmt.Sprintf("privacy manager exited before it was ready: %v", e.err)
+}
+
+func (e *exitedError) Unwrap() error {
+	return e.err
+}
+
+// nodeExits holds the exits of the running nodes started by LaunchNode, which
+// waits for them in the background so as to notice a node exiting before it
+// is ready. StopNode and Supervisor take the exit from here, as a process can
+// only be waited for once. Entries are removed once their node has exited.
+var nodeExits sync.Map // *exec.Cmd -> *nodeExit
+
+// nodeExit is the result of waiting for a node, set once done is closed.
+type nodeExit struct {
+	done chan struct{}
+	err  error
+}
+
+// watchNode waits for the started cmd in the background.
+func watchNode(cmd *exec.Cmd) *nodeExit {
+	exit := &nodeExit{done: make(chan struct{})}
+	nodeExits.Store(cmd, exit)
+	go func() {
+		exit.err = cmd.Wait()
+		close(exit.done)
+		nodeExits.Delete(cmd)
+	}()
+	return exit
+}
+
+// waitNode returns a channel receiving the result of waiting for cmd, taken
+// over from LaunchNode if it started cmd.
+func waitNode(cmd *exec.Cmd) <-chan error {
+	exited := make(chan error, 1)
+	v, ok := nodeExits.Load(cmd)
+	if !ok {
+		if cmd.ProcessState != nil {
+			// Already reaped, by the watcher of LaunchNode or the caller.
+			exited <- exitStatus(cmd.ProcessState)
+			return exited
+		}
+		go func() { exited <- cmd.Wait() }()
+		return exited
+	}
+	nodeExits.Delete(cmd)
+	exit := v.(*nodeExit)
+	go func() {
+		<-exit.done
+		exited <- exit.err
+	}()
+	return exited
+}
+
+// exitStatus returns the error cmd.Wait reports for a process that exited
+// with state.
+func exitStatus(state *os.ProcessState) error {
+	if state.Success() {
+		return nil
+	}
+	return &exec.ExitError{ProcessState: state}
+}
+
+// LaunchError is returned by LaunchNode when the node doesn't come up. It
+// carries the last lines the node wrote to standard error, which usually tell
+// why, e.g. a bad configuration.
+type LaunchError struct {
+	Err    error
+	Stderr []string // up to the last 20 lines, oldest first
+}
+
+func (e *LaunchError) Error() string {
+	if len(e.Stderr) == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v, node's last output:\n%s", e.Err, strings.Join(e.Stderr, "\n"))
+}
+
+func (e *LaunchError) Unwrap() error {
+	return e.Err
+}
+
+// lineLogger logs the output of a node, one entry per line. If tail has a
+// non-zero capacity, it keeps as many of the last lines.
+type lineLogger struct {
+	logf func(msg string, ctx ...interface{})
+
+	mu   sync.Mutex
+	tail []string // ring buffer of the last lines
+	next int      // index of the oldest line once tail is full
+}
+
+// ReadFrom logs every line read from r until it is closed, including a last
+// line without a trailing newline. It is used by io.Copy, and thus exec, in
+// preference to Write.
+func (l *lineLogger) ReadFrom(r io.Reader) (int64, error) {
+	var n int64
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		n += int64(len(line))
+		l.log(line)
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// Write logs the lines in p, which must hold complete lines.
+func (l *lineLogger) Write(p []byte) (int, error) {
+	for _, line := range strings.SplitAfter(string(p), "\n") {
+		l.log(line)
+	}
+	return len(p), nil
+}
+
+func (l *lineLogger) log(line string) {
+	if line = strings.TrimRight(line, "\r\n"); line == "" {
+		return
+	}
+	l.logf(line)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case cap(l.tail) == 0:
+	case len(l.tail) < cap(l.tail):
+		l.tail = append(l.tail, line)
+	default:
+		l.tail[l.next] = line
+		l.next = (l.next + 1) % len(l.tail)
+	}
+}
+
+// lastLines returns the lines kept, oldest first.
+func (l *lineLogger) lastLines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append(append([]string(nil), l.tail[l.next:]...), l.tail[:l.next]...)
+}
+
+// WaitForNodeReady polls the upcheck endpoint of the privacy manager at
+// socketPath until it reports ready, or returns an error once timeout has
+// elapsed. It polls as often as ConstellationReady.
+func WaitForNodeReady(socketPath string, timeout time.Duration) error {
+	ready := ConstellationReady
+	ready.Timeout = timeout
+	return WaitForNodeReadyContext(context.Background(), socketPath, ready)
+}
+
+// WaitForNodeReadyContext is like WaitForNodeReady, polling as configured by
+// ready. It gives up with the context's error once ctx is done.
+func WaitForNodeReadyContext(ctx context.Context, socketPath string, ready ReadyConfig) error {
+	pollCtx, cancel := ctx, context.CancelFunc(func() {})
+	if ready.Timeout > 0 {
+		pollCtx, cancel = context.WithTimeout(ctx, ready.Timeout)
+	}
+	defer cancel()
+
+	c := unixClient(socketPath, newClientConfig(nil))
+	defer c.CloseIdleConnections()
+
+	var lastErr error
+	for delay := ready.InitialDelay; ; delay = ready.PollInterval {
+		timer := time.NewTimer(delay)
+		select {
+		case <-pollCtx.Done():
+			timer.Stop()
+			if ctx.Err() != nil || lastErr == nil {
+				return pollCtx.Err()
+			}
+			return fmt.Errorf("privacy manager at %s not ready after %v: %v", socketPath, ready.Timeout, lastErr)
+		case <-timer.C:
+		}
+		req, err := http.NewRequestWithContext(pollCtx, "GET", unixBaseURL+"upcheck", nil)
+		if err != nil {
+			return err
+		}
+		res, err := c.Do(req)
+		if err == nil {
+			drainAndClose(res)
+			if res.StatusCode == http.StatusOK {
+				return nil
+			}
+			err = fmt.Errorf("upcheck returned status %d", res.StatusCode)
+		}
+		// Prefer the error of a completed upcheck over the one caused by
+		// the timeout interrupting the last attempt.
+		if pollCtx.Err() == nil || lastErr == nil {
+			lastErr = err
+		}
+	}
+}
+
+// NodePID returns the process ID of a node started by LaunchNode, e.g. to
+// correlate it with geth in resource monitoring. It reports false if the
+// process has not been started.
+func NodePID(cmd *exec.Cmd) (int, bool) {
+	if cmd == nil || cmd.Process == nil {
+		return 0, false
+	}
+	return cmd.Process.Pid, true
+}
+
+// DrainAndStop shuts down the privacy manager process cmd once the client c
+// has finished the requests it has in progress, so that the node isn't killed
+// in the middle of a write. New calls on c fail with ErrClientClosed right
+// away. After drainTimeout, the remaining requests are cancelled and their
+// number is returned; c is closed either way. The node is then stopped with
+// StopNode, given stopTimeout to exit.
+func (c *Client) DrainAndStop(cmd *exec.Cmd, drainTimeout, stopTimeout time.Duration) (int, error) {
+	c.inflight.stop()
+	remaining := c.inflight.drain(drainTimeout)
+	c.Close()
+	return remaining, StopNode(cmd, stopTimeout)
+}
+
+// StopNode shuts down a privacy manager process started by LaunchNode. It
+// sends SIGTERM so the node can close its stores cleanly, and kills the process
+// if it has not exited after timeout. The process is reaped in either case.
+func StopNode(cmd *exec.Cmd, timeout time.Duration) error {
+	if cmd == nil || cmd.Process == nil {
+		return errors.New("privacy manager process was not started")
+	}
+	return stopProcess(cmd, waitNode(cmd), timeout)
+}
+
+// stopProcess is StopNode for a process whose exit is reported on exited.
+func stopProcess(cmd *exec.Cmd, exited <-chan error, timeout time.Duration) error {
+	// Not every platform supports SIGTERM, fall back to killing the process.
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		cmd.Process.Kill()
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-exited:
+		if terminatedBy(err, syscall.SIGTERM) {
+			return nil
+		}
+		return err
+	case <-timer.C:
+		cmd.Process.Kill()
+		<-exited
+		return fmt.Errorf("privacy manager did not exit within %v and was killed", timeout)
+	}
+}
+
+// terminatedBy reports whether err is the result of waiting for a process
+// that was ended by sig.
+func terminatedBy(err error, sig syscall.Signal) bool {
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return false
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	return ok && status.Signaled() && status.Signal() == sig
+}
@@ -0,0 +1,459 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// TestMain lets the test binary double as a privacy manager node, so that
+// launching and supervising nodes can be tested with a real process.
+func TestMain(m *testing.M) {
+	if os.Getenv("PTM_TEST_NODE") != "" {
+		runTestNode(os.Args[len(os.Args)-1])
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// runTestNode serves upchecks on the socket configured in cfgPath. If
+// PTM_TEST_NODE_LIFETIME is set, the node crashes once it has elapsed, or
+// exits with PTM_TEST_NODE_EXIT_STATUS if that is set.
+func runTestNode(cfgPath string) {
+	cfg, err := LoadConfig(cfgPath)
+	if err != nil {
+		os.Exit(2)
+	}
+	os.Remove(cfg.SocketFile())
+	l, err := net.Listen("unix", cfg.SocketFile())
+	if err != nil {
+		os.Exit(2)
+	}
+	fmt.Println("test node started")
+	if greeting := os.Getenv("PTM_TEST_NODE_GREETING"); greeting != "" {
+		fmt.Println(greeting)
+	}
+	fmt.Fprintln(os.Stderr, "test node warning")
+	if lifetime, err := time.ParseDuration(os.Getenv("PTM_TEST_NODE_LIFETIME")); err == nil {
+		status := 1
+		if s, err := strconv.Atoi(os.Getenv("PTM_TEST_NODE_EXIT_STATUS")); err == nil {
+			status = s
+		}
+		time.AfterFunc(lifetime, func() { os.Exit(status) })
+	}
+	http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("I'm up!"))
+	}))
+}
+
+// testNodeConfig writes the configuration of a test node into a fresh
+// temporary directory and returns its path. The node binary is the test
+// binary itself.
+func testNodeConfig(t *testing.T, lifetime time.Duration) (string, func()) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires unix sockets")
+	}
+	dir, err := ioutil.TempDir("", "ptm-launch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfgPath := filepath.Join(dir, "tm.conf")
+	if err := ioutil.WriteFile(cfgPath, []byte("socket = \"tm.ipc\"\nworkdir = \""+dir+"\"\n"), 0600); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	os.Setenv("PTM_TEST_NODE", "1")
+	if lifetime > 0 {
+		os.Setenv("PTM_TEST_NODE_LIFETIME", lifetime.String())
+	}
+	return cfgPath, func() {
+		os.Unsetenv("PTM_TEST_NODE")
+		os.Unsetenv("PTM_TEST_NODE_LIFETIME")
+		os.RemoveAll(dir)
+	}
+}
+
+func TestLaunchNodeTesseraConfig(t *testing.T) {
+	cfgPath, cleanup := testNodeConfig(t, 0)
+	defer cleanup()
+
+	// Replace the Constellation configuration with a Tessera one.
+	socketPath := filepath.Join(filepath.Dir(cfgPath), "tm.ipc")
+	tesseraCfg := `{"serverConfigs": [{"app": "Q2T", "serverAddress": "unix:` + socketPath + `"}]}`
+	cfgPath = filepath.Join(filepath.Dir(cfgPath), "tessera-config.json")
+	if err := ioutil.WriteFile(cfgPath, []byte(tesseraCfg), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ready := TesseraReady
+	ready.InitialDelay = 0
+	cmd, err := LaunchNode(os.Args[0], cfgPath, WithReadyConfig(ready))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer StopNode(cmd, 5*time.Second)
+	if err := RunNode(socketPath); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startProcess starts a shell script standing in for the privacy manager.
+func startProcess(t *testing.T, script string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+	cmd := exec.Command("/bin/sh", "-c", script)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return cmd
+}
+
+func TestStopNodeGraceful(t *testing.T) {
+	cmd := startProcess(t, "exec sleep 10")
+	if err := StopNode(cmd, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if cmd.ProcessState == nil {
+		t.Fatal("process was not reaped")
+	}
+}
+
+func TestStopNodeKillsAfterTimeout(t *testing.T) {
+	cmd := startProcess(t, `trap "" TERM; while true; do sleep 0.05; done`)
+	// Give the shell a moment to install its trap.
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	if err := StopNode(cmd, 200*time.Millisecond); err == nil {
+		t.Fatal("expected error for a process ignoring SIGTERM")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("stopping took %v", elapsed)
+	}
+	if cmd.ProcessState == nil {
+		t.Fatal("process was not reaped")
+	}
+}
+
+func TestWaitForNodeReady(t *testing.T) {
+	var calls int32
+	socketPath, shutdown := newTestServer(t, flakyHandler(3, &calls))
+	defer shutdown()
+
+	if err := WaitForNodeReady(socketPath, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 4 {
+		t.Fatalf("got %d upchecks, want 4", calls)
+	}
+}
+
+func TestWaitForNodeReadyTimeout(t *testing.T) {
+	start := time.Now()
+	if err := WaitForNodeReady("/nonexistent/tm.ipc", 200*time.Millisecond); err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("waiting took %v", elapsed)
+	}
+}
+
+func TestNodePIDNotStarted(t *testing.T) {
+	if _, ok := NodePID(nil); ok {
+		t.Fatal("got pid for nil command")
+	}
+	if _, ok := NodePID(exec.Command("true")); ok {
+		t.Fatal("got pid for command that was not started")
+	}
+}
+
+func TestLaunchNodeMissingBinary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ptm-launch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfgPath := filepath.Join(dir, "tm.conf")
+	if err := ioutil.WriteFile(cfgPath, []byte("socket = \"tm.ipc\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LaunchNode(filepath.Join(dir, "no-such-node"), cfgPath); err == nil {
+		t.Fatal("expected error for missing binary")
+	}
+}
+
+// recordingLogger returns a logger that keeps the records it is given.
+func recordingLogger() (log.Logger, func() []*log.Record) {
+	var (
+		mu      sync.Mutex
+		records []*log.Record
+	)
+	logger := log.New()
+	logger.SetHandler(log.FuncHandler(func(r *log.Record) error {
+		mu.Lock()
+		defer mu.Unlock()
+		records = append(records, r)
+		return nil
+	}))
+	return logger, func() []*log.Record {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*log.Record(nil), records...)
+	}
+}
+
+func TestLaunchNode(t *testing.T) {
+	cfgPath, cleanup := testNodeConfig(t, 0)
+	defer cleanup()
+
+	logger, records := recordingLogger()
+	cmd, err := LaunchNode(os.Args[0], cfgPath, WithNodeLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pid, ok := NodePID(cmd); !ok || pid != cmd.Process.Pid {
+		t.Fatalf("got pid %d, %v, want %d", pid, ok, cmd.Process.Pid)
+	}
+	if err := StopNode(cmd, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]log.Lvl{"test node started": log.LvlInfo, "test node warning": log.LvlWarn}
+	for _, r := range records() {
+		if lvl, ok := want[r.Msg]; ok && lvl == r.Lvl {
+			delete(want, r.Msg)
+		}
+	}
+	if len(want) > 0 {
+		t.Fatalf("node output not logged: %v", want)
+	}
+}
+
+func TestLaunchNodeKilled(t *testing.T) {
+	cfgPath, cleanup := testNodeConfig(t, 0)
+	defer cleanup()
+
+	logger, _ := recordingLogger()
+	cmd, err := LaunchNode(os.Args[0], cfgPath, WithNodeLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A node killed by the caller is reaped, and forgotten, in the background.
+	cmd.Process.Kill()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := nodeExits.Load(cmd); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("exit of killed node still tracked")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if cmd.ProcessState == nil {
+		t.Fatal("killed node was not reaped")
+	}
+	if err := StopNode(cmd, 5*time.Second); !terminatedBy(err, syscall.SIGKILL) {
+		t.Fatalf("got error %v stopping killed node, want its exit status", err)
+	}
+}
+
+func TestLaunchNodeOutputGoroutines(t *testing.T) {
+	cfgPath, cleanup := testNodeConfig(t, 0)
+	defer cleanup()
+
+	baseline := runtime.NumGoroutine()
+	logger, _ := recordingLogger()
+	for i := 0; i < 5; i++ {
+		cmd, err := LaunchNode(os.Args[0], cfgPath, WithNodeLogger(logger))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := StopNode(cmd, 5*time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitForGoroutines(t, baseline)
+}
+
+func TestLineLogger(t *testing.T) {
+	var lines []string
+	l := &lineLogger{logf: func(msg string, ctx ...interface{}) { lines = append(lines, msg) }}
+	n, err := l.ReadFrom(strings.NewReader("one\r\n\ntwo\nthree"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 15 {
+		t.Fatalf("got %d bytes read, want 15", n)
+	}
+	if want := []string{"one", "two", "three"}; !reflect.DeepEqual(lines, want) {
+		t.Fatalf("got lines %q, want %q", lines, want)
+	}
+}
+
+func TestLaunchNodeEnv(t *testing.T) {
+	cfgPath, cleanup := testNodeConfig(t, 0)
+	defer cleanup()
+
+	logger, records := recordingLogger()
+	cmd, err := LaunchNode(os.Args[0], cfgPath, WithNodeLogger(logger), WithNodeEnv("PTM_TEST_NODE_GREETING=hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := StopNode(cmd, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records() {
+		if r.Msg == "hello" {
+			return
+		}
+	}
+	t.Fatal("node did not see the extra environment variable")
+}
+
+func TestDrainAndStop(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.Write([]byte("0.10.2"))
+	}))
+	defer shutdown()
+	defer close(release)
+
+	for _, finish := range []bool{true, false} {
+		c, err := NewClient(socketPath, WithRequestTimeout(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error, 1)
+		go func() {
+			_, err := c.GetVersion(context.Background())
+			done <- err
+		}()
+		<-started
+		if finish {
+			time.AfterFunc(50*time.Millisecond, func() { release <- struct{}{} })
+		}
+
+		cmd := startProcess(t, "exec sleep 10")
+		remaining, err := c.DrainAndStop(cmd, 500*time.Millisecond, 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cmd.ProcessState == nil {
+			t.Fatal("process was not reaped")
+		}
+		wantRemaining, wantErr := 0, error(nil)
+		if !finish {
+			wantRemaining, wantErr = 1, ErrClientClosed
+		}
+		if remaining != wantRemaining {
+			t.Fatalf("got %d requests remaining, want %d", remaining, wantRemaining)
+		}
+		if err := <-done; err != wantErr {
+			t.Fatalf("got error %v for request in progress, want %v", err, wantErr)
+		}
+		if _, err := c.GetVersion(context.Background()); err != ErrClientClosed {
+			t.Fatalf("got error %v after stopping, want %v", err, ErrClientClosed)
+		}
+	}
+}
+
+func TestWaitForNodeReadyContext(t *testing.T) {
+	var calls int32
+	socketPath, shutdown := newTestServer(t, flakyHandler(1, &calls))
+	defer shutdown()
+
+	start := time.Now()
+	ready := ReadyConfig{InitialDelay: 100 * time.Millisecond, PollInterval: 100 * time.Millisecond, Timeout: 5 * time.Second}
+	if err := WaitForNodeReadyContext(context.Background(), socketPath, ready); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("2 upchecks done within %v, want the initial delay and poll interval respected", elapsed)
+	}
+	if calls != 2 {
+		t.Fatalf("got %d upchecks, want 2", calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start = time.Now()
+	err := WaitForNodeReadyContext(ctx, "/nonexistent/tm.ipc", ReadyConfig{PollInterval: 10 * time.Millisecond})
+	if err != context.Canceled {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("waiting took %v", elapsed)
+	}
+}
+
+func TestLaunchNodeStderrTail(t *testing.T) {
+	cfgPath, cleanup := testNodeConfig(t, 0)
+	defer cleanup()
+
+	script := filepath.Join(filepath.Dir(cfgPath), "bad-node")
+	body := "#!/bin/sh\ni=1\nwhile [ $i -le 30 ]; do echo \"error $i\" >&2; i=$((i+1)); done\nexit 1\n"
+	if err := ioutil.WriteFile(script, []byte(body), 0700); err != nil {
+		t.Fatal(err)
+	}
+	logger, _ := recordingLogger()
+	ready := ReadyConfig{PollInterval: 10 * time.Millisecond, Timeout: 300 * time.Millisecond}
+	_, err := LaunchNode(script, cfgPath, WithNodeLogger(logger), WithReadyConfig(ready))
+
+	launchErr, ok := err.(*LaunchError)
+	if !ok {
+		t.Fatalf("got error %v, want *LaunchError", err)
+	}
+	if len(launchErr.Stderr) != stderrTailLines {
+		t.Fatalf("got %d lines of stderr, want %d: %q", len(launchErr.Stderr), stderrTailLines, launchErr.Stderr)
+	}
+	if first, last := launchErr.Stderr[0], launchErr.Stderr[stderrTailLines-1]; first != "error 11" || last != "error 30" {
+		t.Fatalf("got stderr from %q to %q, want the last lines", first, last)
+	}
+	if !strings.Contains(err.Error(), "error 30") {
+		t.Fatalf("error %q lacks the node's output", err)
+	}
+}
+
+func TestLaunchNodeExitsEarly(t *testing.T) {
+	cfgPath, cleanup := testNodeConfig(t, 0)
+	defer cleanup()
+
+	script := filepath.Join(filepath.Dir(cfgPath), "failing-node")
+	if err := ioutil.WriteFile(script, []byte("#!/bin/sh\necho \"port in use\" >&2\nexit 3\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	logger, _ := recordingLogger()
+	start := time.Now()
+	_, err := LaunchNode(script, cfgPath, WithNodeLogger(logger), WithReadyConfig(TesseraReady))
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("launching a node that exits took %v", elapsed)
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("got error %v, want exit status 3", err)
+	}
+	if !strings.Contains(err.Error(), "exited before it was ready") || !strings.Contains(err.Error(), "port in use") {
+		t.Fatalf("error %q lacks the exit or the node's output", err)
+	}
+}
@@ -0,0 +1,40 @@
+package privatetransactionmanager
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// publicKeyLength is the size of the NaCl box keys used by Constellation and
+// Tessera.
+const publicKeyLength = 32
+
+// PublicKey is the base64 encoded public key of a privacy manager party, as
+// used to address payloads.
+type PublicKey string
+
+// ParsePublicKey validates a base64 encoded public key.
+func ParsePublicKey(b64 string) (PublicKey, error) {
+	b, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return "", fmt.Errorf("invalid public key %q: %v", b64, err)
+	}
+	if len(b) != publicKeyLength {
+		return "", fmt.Errorf("invalid public key %q: have %d bytes, want %d", b64, len(b), publicKeyLength)
+	}
+	return PublicKey(b64), nil
+}
+
+// Bytes returns the decoded key, or nil if the key is not valid base64.
+func (k PublicKey) Bytes() []byte {
+	b, err := base64.StdEncoding.DecodeString(string(k))
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// String returns the base64 encoding of the key.
+func (k PublicKey) String() string {
+	return string(k)
+}
@@ -0,0 +1,23 @@
+package privatetransactionmanager
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+)
+
+func TestParsePublicKey(t *testing.T) {
+	raw := bytes.Repeat([]byte{1}, publicKeyLength)
+	key, err := ParsePublicKey(base64.StdEncoding.EncodeToString(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key.Bytes(), raw) {
+		t.Fatalf("got bytes %x, want %x", key.Bytes(), raw)
+	}
+	for _, invalid := range []string{"", "not base64!", base64.StdEncoding.EncodeToString(raw[1:])} {
+		if _, err := ParsePublicKey(invalid); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
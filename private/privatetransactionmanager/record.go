@@ -0,0 +1,287 @@
+package privatetransactionmanager
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// recording is the file format written by a Recorder.
+type recording struct {
+	// Redacted is set if keys have been replaced by their fingerprint.
+	Redacted     bool                  `json:"redacted"`
+	Interactions []recordedInteraction `json:"interactions"`
+}
+
+// recordedInteraction is a request and the response it got. Request bodies
+// are not recorded, as they hold the payloads sent.
+type recordedInteraction struct {
+	Method         string      `json:"method"`
+	Path           string      `json:"path"`
+	Query          string      `json:"query,omitempty"`
+	Recipients     []string    `json:"recipients,omitempty"`
+	Header         http.Header `json:"header,omitempty"`
+	Status         int         `json:"status"`
+	ResponseHeader http.Header `json:"responseHeader,omitempty"`
+	ResponseBody   []byte      `json:"responseBody,omitempty"`
+}
+
+// matchKey returns the key a replayed request is matched on: its method, path,
+// query and set of recipients.
+func (ri *recordedInteraction) matchKey() string {
+	return ri.Method + " " + ri.requestURI() + " " + strings.Join(ri.Recipients, ",")
+}
+
+// requestURI returns the path and query of the request.
+func (ri *recordedInteraction) requestURI() string {
+	if ri.Query == "" {
+		return ri.Path
+	}
+	return ri.Path + "?" + ri.Query
+}
+
+// recordedQuery returns the query of u in canonical form, with its values, such
+// as a recipient key, replaced by their fingerprint if redact is set.
+func recordedQuery(u *url.URL, redact bool) string {
+	if u.RawQuery == "" {
+		return ""
+	}
+	query := u.Query()
+	if redact {
+		for name, values := range query {
+			query[name] = fingerprintKeys(values)
+		}
+	}
+	return query.Encode()
+}
+
+// Recorder captures the requests a client sends to the privacy manager and
+// the responses it gets, so that they can be saved to a file and replayed by
+// a Replayer in tests of caller code. Install it with
+// WithRoundTripper(rec.Wrap).
+//
+// Unless the recorder is created with allowKeys, the keys in request headers
+// and query parameters are replaced by a fingerprint, which still tells keys
+// apart for replaying. The fingerprint is a hash of the key, so a key can
+// still be recognised by whoever knows it. Response headers and bodies are
+// always stored verbatim, since the code under test reads them: a recording of
+// a receive still holds the sender's key in its c11n-from header, and one of,
+// e.g., GetParticipants the keys in its body. Requests that failed without a
+// response are not recorded.
+type Recorder struct {
+	path      string
+	allowKeys bool
+
+	mu           sync.Mutex
+	interactions []recordedInteraction
+}
+
+// NewRecorder creates a recorder that saves its recording to path.
+func NewRecorder(path string, allowKeys bool) *Recorder {
+	return &Recorder{path: path, allowKeys: allowKeys}
+}
+
+// Wrap returns a transport recording the requests sent through next.
+func (r *Recorder) Wrap(next http.RoundTripper) http.RoundTripper {
+	return &recordTransport{rec: r, next: next}
+}
+
+// Save writes the interactions recorded so far to the recorder's file.
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	rec := recording{Redacted: !r.allowKeys, Interactions: r.interactions}
+	out, err := json.MarshalIndent(rec, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.path, out, 0600)
+}
+
+type recordTransport struct {
+	rec  *Recorder
+	next http.RoundTripper
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recipients, err := requestRecipients(req)
+	if err != nil {
+		return nil, err
+	}
+	header := req.Header.Clone()
+	if !t.rec.allowKeys {
+		recipients = fingerprintKeys(recipients)
+		for name, values := range header {
+			if redactedHeaders[http.CanonicalHeaderKey(name)] {
+				header[name] = fingerprintKeys(values)
+			}
+		}
+	}
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	t.rec.mu.Lock()
+	t.rec.interactions = append(t.rec.interactions, recordedInteraction{
+		Method:         req.Method,
+		Path:           req.URL.Path,
+		Query:          recordedQuery(req.URL, !t.rec.allowKeys),
+		Recipients:     recipients,
+		Header:         header,
+		Status:         res.StatusCode,
+		ResponseHeader: res.Header.Clone(),
+		ResponseBody:   body,
+	})
+	t.rec.mu.Unlock()
+	return res, nil
+}
+
+// Replayer answers requests with the responses saved by a Recorder, without
+// contacting a privacy manager. Install it with WithRoundTripper(rep.Wrap).
+// A request is matched to a recorded one with the same method, path, query and
+// set of recipients, regardless of their order; requests that match several
+// recorded ones get their responses in the order they were recorded, each
+// once. Requests without a recorded response left fail.
+type Replayer struct {
+	redacted bool
+
+	mu        sync.Mutex
+	responses map[string][]recordedInteraction
+}
+
+// NewReplayer loads the recording saved at path.
+func NewReplayer(path string) (*Replayer, error) {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rec recording
+	if err := json.Unmarshal(in, &rec); err != nil {
+		return nil, fmt.Errorf("invalid recording %s: %v", path, err)
+	}
+	r := &Replayer{redacted: rec.Redacted, responses: make(map[string][]recordedInteraction)}
+	for _, ri := range rec.Interactions {
+		key := ri.matchKey()
+		r.responses[key] = append(r.responses[key], ri)
+	}
+	return r, nil
+}
+
+// Wrap returns the replayer itself; next is never used.
+func (r *Replayer) Wrap(next http.RoundTripper) http.RoundTripper {
+	return r
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	recipients, err := requestRecipients(req)
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.redacted {
+		recipients = fingerprintKeys(recipients)
+	}
+	ri := recordedInteraction{
+		Method:     req.Method,
+		Path:       req.URL.Path,
+		Query:      recordedQuery(req.URL, r.redacted),
+		Recipients: recipients,
+	}
+	key := ri.matchKey()
+
+	r.mu.Lock()
+	queue := r.responses[key]
+	if len(queue) == 0 {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("no recorded response left for %s %s with %d recipients", req.Method, ri.requestURI(), len(recipients))
+	}
+	ri, r.responses[key] = queue[0], queue[1:]
+	r.mu.Unlock()
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", ri.Status, http.StatusText(ri.Status)),
+		StatusCode:    ri.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        ri.ResponseHeader.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(ri.ResponseBody)),
+		ContentLength: int64(len(ri.ResponseBody)),
+		Request:       req,
+	}, nil
+}
+
+// requestRecipients returns the sorted recipients of req, taken from its
+// c11n-to headers or, for the JSON API, the to field of its body.
+func requestRecipients(req *http.Request) ([]string, error) {
+	recipients := headerRecipients(req.Header)
+	if len(recipients) == 0 && req.GetBody != nil && strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		var r io.Reader = body
+		if req.Header.Get("Content-Encoding") == "gzip" {
+			if r, err = gzip.NewReader(body); err != nil {
+				return nil, err
+			}
+		}
+		var fields struct {
+			To []string `json:"to"`
+		}
+		if err := json.NewDecoder(r).Decode(&fields); err == nil {
+			recipients = fields.To
+		}
+	}
+	sort.Strings(recipients)
+	return recipients, nil
+}
+
+// headerRecipients returns the recipients in the c11n-to headers of h, which
+// may hold a comma separated list each.
+func headerRecipients(h http.Header) []string {
+	var recipients []string
+	for _, value := range h[http.CanonicalHeaderKey("c11n-to")] {
+		for _, to := range strings.Split(value, ",") {
+			if to = strings.TrimSpace(to); to != "" {
+				recipients = append(recipients, to)
+			}
+		}
+	}
+	return recipients
+}
+
+// fingerprintKeys replaces each of the comma separated keys in values by a
+// fingerprint derived from the key.
+func fingerprintKeys(values []string) []string {
+	out := make([]string, len(values))
+	for i, value := range values {
+		keys := strings.Split(value, ",")
+		for j, key := range keys {
+			sum := sha256.Sum256([]byte(strings.TrimSpace(key)))
+			keys[j] = "redacted-" + hex.EncodeToString(sum[:8])
+		}
+		out[i] = strings.Join(keys, ",")
+	}
+	return out
+}
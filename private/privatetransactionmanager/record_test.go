@@ -0,0 +1,175 @@
+package privatetransactionmanager
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sendraw":
+			w.Write([]byte(testPayloadHash.ToBase64()))
+		case "/receiveraw":
+			w.Write([]byte("payload"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer shutdown()
+
+	dir, err := ioutil.TempDir("", "ptm-record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	record := func(path string, allowKeys bool) {
+		t.Helper()
+		rec := NewRecorder(path, allowKeys)
+		c, err := NewClient(socketPath, WithRoundTripper(rec.Wrap))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.SendPayload(ctx, []byte("payload"), "", []string{testRecipient, testKey(3)}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.ReceivePayload(ctx, testPayloadHash.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		if err := rec.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	redactedPath, plainPath := filepath.Join(dir, "redacted.json"), filepath.Join(dir, "plain.json")
+	record(redactedPath, false)
+	record(plainPath, true)
+
+	saved, err := ioutil.ReadFile(redactedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{testRecipient, testKey(3)} {
+		if strings.Contains(string(saved), secret) {
+			t.Fatalf("recording leaks key %s:\n%s", secret, saved)
+		}
+	}
+	if saved, err = ioutil.ReadFile(plainPath); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(saved), testRecipient) {
+		t.Fatalf("recording made with allowKeys lacks the recipient:\n%s", saved)
+	}
+
+	for _, path := range []string{redactedPath, plainPath} {
+		rep, err := NewReplayer(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := NewClient("/nonexistent/tm.ipc", WithRoundTripper(rep.Wrap))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.SendPayload(ctx, []byte("payload"), "", []string{testRecipient}); err == nil {
+			t.Fatal("replayed a send to other recipients")
+		}
+		hash, err := c.SendPayload(ctx, []byte("other payload"), "", []string{testKey(3), testRecipient})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash != testPayloadHash {
+			t.Fatalf("replayed hash %x, want %x", hash, testPayloadHash)
+		}
+		pl, err := c.ReceivePayload(ctx, testPayloadHash.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(pl, []byte("payload")) {
+			t.Fatalf("replayed payload %q, want %q", pl, "payload")
+		}
+		if _, err := c.ReceivePayload(ctx, testPayloadHash.Bytes()); err == nil {
+			t.Fatal("replayed a response twice")
+		}
+	}
+}
+
+func TestReplayMatchesQuery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Query().Get("to")))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "ptm-record")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "recording.json")
+
+	get := func(client *http.Client, to string) (string, error) {
+		res, err := client.Get(srv.URL + "/transaction/hash?" + url.Values{"to": {to}}.Encode())
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		return string(body), err
+	}
+	rec := NewRecorder(path, false)
+	recording := &http.Client{Transport: rec.Wrap(http.DefaultTransport)}
+	for _, to := range []string{testKey(1), testKey(2)} {
+		if _, err := get(recording, to); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The response bodies echo the keys, so only the queries are checked.
+	if strings.Contains(string(saved), url.QueryEscape(testKey(1))) {
+		t.Fatalf("recorded query leaks key:\n%s", saved)
+	}
+
+	rep, err := NewReplayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replaying := &http.Client{Transport: rep}
+	for _, to := range []string{testKey(2), testKey(1)} {
+		got, err := get(replaying, to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != to {
+			t.Fatalf("replayed response %q for to=%s", got, to)
+		}
+	}
+	if _, err := get(replaying, testKey(3)); err == nil || !strings.Contains(err.Error(), "/transaction/hash?to=") {
+		t.Fatalf("got error %v for a query not recorded, want one naming it", err)
+	}
+}
+
+func TestHeaderRecipients(t *testing.T) {
+	h := make(http.Header)
+	h.Add("c11n-to", testKey(1)+", "+testKey(2))
+	h.Add("c11n-to", testKey(3))
+	if got := headerRecipients(h); len(got) != 3 || got[1] != testKey(2) || got[2] != testKey(3) {
+		t.Fatalf("got recipients %q, want 3", got)
+	}
+	if got := headerRecipients(http.Header{}); len(got) != 0 {
+		t.Fatalf("got recipients %q without header", got)
+	}
+}
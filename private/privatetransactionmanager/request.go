@@ -0,0 +1,225 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// operation describes a privacy manager API call.
+type operation struct {
+	name string
+
+	// idempotent operations can be repeated without side effects on the
+	// privacy manager, so they may be retried after any transient failure.
+	idempotent bool
+
+	// compressible operations carry payload data in their request body,
+	// which is gzip compressed if the client has compression enabled.
+	compressible bool
+}
+
+var (
+	opSendRaw            = operation{name: "sendraw", compressible: true}
+	opSend               = operation{name: "send", compressible: true}
+	opStoreRaw           = operation{name: "storeraw"}
+	opSendSignedTx       = operation{name: "sendsignedtx"}
+	opReceiveRaw         = operation{name: "receiveraw", idempotent: true}
+	opReceive            = operation{name: "receive", idempotent: true}
+	opIsSender           = operation{name: "issender", idempotent: true}
+	opTransaction        = operation{name: "transaction", idempotent: true}
+	opGetParticipants    = operation{name: "participants", idempotent: true}
+	opVersion            = operation{name: "version", idempotent: true}
+	opPartyInfo          = operation{name: "partyinfo", idempotent: true}
+	opDelete             = operation{name: "delete"}
+	opPush               = operation{name: "push"}
+	opResend             = operation{name: "resend", idempotent: true}
+	opCreatePrivacyGroup = operation{name: "createprivacygroup"}
+	opFindPrivacyGroups  = operation{name: "findprivacygroups", idempotent: true}
+	opDeletePrivacyGroup = operation{name: "deleteprivacygroup"}
+	opUpcheck            = operation{name: "upcheck", idempotent: true}
+)
+
+// do sends req to the privacy manager, retrying transient failures according
+// to the client's retry settings. Responses without a 2xx status are turned
+// into a *StatusError; otherwise the caller is responsible for closing the body.
+// The optional key/value pairs in ctx, such as the hash of the payload
+// concerned, are added to the request's log line.
+func (c *Client) do(op operation, req *http.Request, ctx ...interface{}) (*http.Response, error) {
+	if c.cfg.compression {
+		if op.compressible {
+			if err := compressRequest(req); err != nil {
+				return nil, err
+			}
+		}
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+	callCtx, release, err := c.inflight.acquire(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(callCtx)
+	c.meterRequest(req)
+	span, req := c.startSpan(op, req)
+	start := time.Now()
+	res, err := c.send(op, req)
+	code := 0
+	if err != nil {
+		release()
+		if c.inflight.wasCancelled() {
+			err = ErrClientClosed
+		}
+	} else {
+		res.Body = &cancelBody{ReadCloser: res.Body, cancel: release}
+		if code = res.StatusCode; !isSuccess(code) {
+			res, err = nil, newStatusError(res)
+		}
+	}
+	elapsed := time.Since(start)
+	finishSpan(span, code, err)
+	c.metrics.observe(op, req, res, code, elapsed)
+	c.expvars.observe(err)
+	c.logRequest(op, err, elapsed, ctx)
+	if err != nil {
+		return nil, err
+	}
+	res.Body = c.metrics.meterBody(res.Body)
+	res.Body = c.expvars.countBody(res.Body)
+	if err := decompressResponse(res); err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	return res, nil
+}
+
+// meterRequest counts the bytes read from the body of req as sent, including
+// those of attempts that are retried or fail over.
+func (c *Client) meterRequest(req *http.Request) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return
+	}
+	meter := func(body io.ReadCloser) io.ReadCloser {
+		return c.expvars.countRequestBody(c.metrics.meterRequestBody(body))
+	}
+	req.Body = meter(req.Body)
+	if getBody := req.GetBody; getBody != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return meter(body), nil
+		}
+	}
+}
+
+// isSuccess reports whether a response status code denotes success.
+func isSuccess(code int) bool {
+	return code >= 200 && code < 300
+}
+
+// logRequest emits the log line of a completed request. Client errors such as
+// an unknown payload are expected during normal operation and only logged at
+// debug level.
+func (c *Client) logRequest(op operation, err error, elapsed time.Duration, ctx []interface{}) {
+	ctx = append([]interface{}{"op", op.name, "elapsed", common.PrettyDuration(elapsed)}, ctx...)
+
+	var statusErr *StatusError
+	switch {
+	case err == nil:
+		c.cfg.logger.Debug("Privacy manager request succeeded", ctx...)
+	case errors.As(err, &statusErr) && statusErr.Code < http.StatusInternalServerError:
+		c.cfg.logger.Debug("Privacy manager request rejected", append(ctx, "status", statusErr.Code)...)
+	default:
+		c.cfg.logger.Error("Privacy manager request failed", append(ctx, "err", err)...)
+	}
+}
+
+// send performs req, retrying it as long as the retry settings allow.
+func (c *Client) send(op operation, req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		if c.limiter != nil {
+			if err := c.limiter.Wait(req.Context()); err != nil {
+				return nil, err
+			}
+		}
+		res, cancel, err := c.attempt(req)
+		if !c.cfg.retry.shouldRetry(op, req, attempt, res, err) {
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			res.Body = &cancelBody{ReadCloser: res.Body, cancel: cancel}
+			return res, nil
+		}
+		if res != nil {
+			drainAndClose(res)
+		}
+		cancel()
+		if err := c.cfg.retry.wait(req.Context(), attempt); err != nil {
+			return nil, err
+		}
+		if req, err = rewind(req); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attempt sends req once, limited by the request timeout or the call's
+// timeout set with WithCallTimeout. cancel releases the attempt's context and
+// must be called once the response has been read.
+func (c *Client) attempt(req *http.Request) (res *http.Response, cancel context.CancelFunc, err error) {
+	timeout := c.cfg.requestTimeout
+	if d, ok := req.Context().Value(callTimeoutKey{}).(time.Duration); ok {
+		timeout = d
+	}
+	httpClient := c.currentHTTPClient()
+	if timeout <= 0 {
+		res, err := httpClient.Do(req)
+		return res, func() {}, err
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	res, err = httpClient.Do(req.WithContext(ctx))
+	return res, cancel, err
+}
+
+// cancelBody calls cancel when closed, to release the context or the
+// in-flight slot of the request it belongs to.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+type callTimeoutKey struct{}
+
+// WithCallTimeout returns a copy of ctx that gives the calls made with it
+// timeout instead of the client's request timeout, e.g. to allow a very large
+// send more time while keeping other calls short. Zero means no limit. As with
+// the request timeout, every attempt of a retried call gets the full timeout,
+// and the call still ends no later than ctx's own deadline.
+func WithCallTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, callTimeoutKey{}, timeout)
+}
+
+// rewind returns a copy of req with a fresh body, ready to be sent again.
+func rewind(req *http.Request) (*http.Request, error) {
+	next := req.Clone(req.Context())
+	if req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		next.Body = body
+	}
+	return next, nil
+}
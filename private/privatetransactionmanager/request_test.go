@@ -0,0 +1,78 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+func TestLogRequest(t *testing.T) {
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, _ := base64.StdEncoding.DecodeString(r.Header.Get("c11n-key"))
+		switch string(key) {
+		case "known":
+			w.Write([]byte("payload"))
+		case "broken":
+			http.Error(w, "boom", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer shutdown()
+
+	logger, records := recordingLogger()
+	c, err := NewClient(socketPath, WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		key    string
+		lvl    log.Lvl
+		msg    string
+		want   map[string]interface{} // key/values logged besides op and hash
+		logErr bool
+	}{
+		{"known", log.LvlDebug, "Privacy manager request succeeded", nil, false},
+		{"unknown", log.LvlDebug, "Privacy manager request rejected", map[string]interface{}{"status": http.StatusNotFound}, false},
+		{"broken", log.LvlError, "Privacy manager request failed", nil, true},
+	}
+	for _, test := range tests {
+		before := len(records())
+		c.ReceivePayload(context.Background(), []byte(test.key))
+
+		logged := records()[before:]
+		if len(logged) != 1 {
+			t.Fatalf("%s: got %d log records, want 1", test.key, len(logged))
+		}
+		r := logged[0]
+		if r.Lvl != test.lvl || r.Msg != test.msg {
+			t.Errorf("%s: got %v %q, want %v %q", test.key, r.Lvl, r.Msg, test.lvl, test.msg)
+		}
+		ctx := make(map[string]interface{})
+		for i := 0; i+1 < len(r.Ctx); i += 2 {
+			ctx[r.Ctx[i].(string)] = r.Ctx[i+1]
+		}
+		want := map[string]interface{}{
+			"op":   "receiveraw",
+			"hash": common.BytesToEncryptedPayloadHash([]byte(test.key)).TerminalString(),
+		}
+		for k, v := range test.want {
+			want[k] = v
+		}
+		for k, v := range want {
+			if got, ok := ctx[k]; !ok || got != v {
+				t.Errorf("%s: got %s %v, want %v", test.key, k, got, v)
+			}
+		}
+		if _, ok := ctx["err"].(error); ok != test.logErr {
+			t.Errorf("%s: got err %v, want one logged: %t", test.key, ctx["err"], test.logErr)
+		}
+		if _, ok := ctx["elapsed"]; !ok {
+			t.Errorf("%s: elapsed time not logged", test.key)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+)
+
+// maxRetryDelay caps the exponential backoff between two attempts.
+const maxRetryDelay = 5 * time.Second
+
+// RetryPolicy reports whether a failed attempt may be retried. It is called
+// with the status code of an unsuccessful response, or with the transport error if
+// no response was received.
+type RetryPolicy func(statusCode int, err error) bool
+
+// DefaultRetryPolicy retries connection failures, such as a refused
+// connection or a missing socket while the node restarts, connections closed
+// before a response was read, and 502, 503 and 504 responses.
+func DefaultRetryPolicy(statusCode int, err error) bool {
+	if err != nil {
+		return isTransientError(err)
+	}
+	switch statusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func isTransientError(err error) bool {
+	if isDialError(err) {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// isDialError reports whether err happened while connecting, in which case
+// the request was never delivered to the privacy manager.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return isRefused(err)
+}
+
+// isRefused reports whether err is the failure to connect to a privacy
+// manager that isn't listening, such as one that is restarting: a refused
+// connection or a missing socket. Such failures are reported right away, not
+// after the dial timeout.
+func isRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, os.ErrNotExist)
+}
+
+// retryConfig holds the retry settings of a Client. The zero value disables
+// retries.
+type retryConfig struct {
+	maxAttempts     int
+	baseDelay       time.Duration
+	policy          RetryPolicy
+	failFastRefused bool // never retry refused connections
+}
+
+// shouldRetry decides whether the given failed attempt is retried. Requests
+// that are not idempotent, i.e. sends, are only retried if they never reached
+// the privacy manager, so a payload is never distributed twice.
+func (r *retryConfig) shouldRetry(op operation, req *http.Request, attempt int, res *http.Response, err error) bool {
+	if attempt >= r.maxAttempts || req.Context().Err() != nil {
+		return false
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return false
+	}
+	if err == nil && isSuccess(res.StatusCode) {
+		return false
+	}
+	if err != nil && r.failFastRefused && isRefused(err) {
+		return false
+	}
+	if !op.idempotent && (err == nil || !isDialError(err)) {
+		return false
+	}
+	policy := r.policy
+	if policy == nil {
+		policy = DefaultRetryPolicy
+	}
+	if err != nil {
+		return policy(0, err)
+	}
+	return policy(res.StatusCode, nil)
+}
+
+// wait sleeps for the jittered backoff delay that follows the given attempt,
+// returning early with an error if ctx is done.
+func (r *retryConfig) wait(ctx context.Context, attempt int) error {
+	if r.baseDelay <= 0 {
+		// Retry at once.
+		return ctx.Err()
+	}
+	delay := r.baseDelay << uint(attempt-1)
+	if delay > maxRetryDelay || delay <= 0 {
+		// A non-positive delay is the shift overflowing.
+		delay = maxRetryDelay
+	}
+	if half := int64(delay / 2); half > 0 {
+		delay = time.Duration(half + rand.Int63n(half+1))
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drainAndClose discards the remainder of a response body so the underlying
+// connection can be reused.
+func drainAndClose(res *http.Response) {
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+}
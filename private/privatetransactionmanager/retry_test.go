@@ -0,0 +1,168 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyHandler answers with 503 until it has been called failures times.
+func flakyHandler(failures int32, calls *int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(calls, 1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+}
+
+func TestRetryIdempotentOperation(t *testing.T) {
+	var calls int32
+	socketPath, shutdown := newTestServer(t, flakyHandler(2, &calls))
+	defer shutdown()
+
+	c, err := NewClient(socketPath, WithRetry(3, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl, err := c.ReceivePayload(context.Background(), []byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(pl) != "ok" {
+		t.Fatalf("got payload %q, want %q", pl, "ok")
+	}
+	if calls != 3 {
+		t.Fatalf("got %d attempts, want 3", calls)
+	}
+}
+
+func TestRetryWithoutDelay(t *testing.T) {
+	var calls int32
+	socketPath, shutdown := newTestServer(t, flakyHandler(2, &calls))
+	defer shutdown()
+
+	c, err := NewClient(socketPath, WithRetry(3, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := c.ReceivePayload(context.Background(), []byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("retrying without delay took %v", elapsed)
+	}
+	if calls != 3 {
+		t.Fatalf("got %d attempts, want 3", calls)
+	}
+}
+
+func TestRetryNeverResendsPayload(t *testing.T) {
+	var calls int32
+	socketPath, shutdown := newTestServer(t, flakyHandler(1, &calls))
+	defer shutdown()
+
+	c, err := NewClient(socketPath, WithRetry(3, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SendPayload(context.Background(), []byte("payload"), "", []string{testRecipient}); err == nil {
+		t.Fatal("expected send to fail")
+	}
+	if calls != 1 {
+		t.Fatalf("send delivered %d times, want 1", calls)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	var calls int32
+	socketPath, shutdown := newTestServer(t, flakyHandler(1, &calls))
+	defer shutdown()
+
+	never := func(int, error) bool { return false }
+	c, err := NewClient(socketPath, WithRetry(3, time.Millisecond), WithRetryPolicy(never))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ReceivePayload(context.Background(), []byte("key")); err == nil {
+		t.Fatal("expected receive to fail")
+	}
+	if calls != 1 {
+		t.Fatalf("got %d attempts, want 1", calls)
+	}
+}
+
+func TestFailFastOnRefused(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ptm-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "tm.ipc")
+
+	c, err := NewClient(socketPath, WithRetry(5, 200*time.Millisecond), WithFailFastOnRefused())
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := c.GetVersion(context.Background()); err == nil {
+		t.Fatal("expected error for missing socket")
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Fatalf("failing took %v, want no retries", elapsed)
+	}
+}
+
+func TestRestartWait(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ptm-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "tm.ipc")
+
+	// The node comes back while the call waits.
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("0.10.2"))
+	}))
+	defer srv.Close()
+	time.AfterFunc(200*time.Millisecond, func() {
+		l, err := net.Listen("unix", socketPath)
+		if err != nil {
+			return
+		}
+		srv.Listener = l
+		srv.Start()
+	})
+	c, err := NewClient(socketPath, WithRestartWait(5*time.Second), WithFailFastOnRefused())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetVersion(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The wait ends at the call's deadline.
+	c, err = NewClient(filepath.Join(dir, "missing.ipc"), WithRestartWait(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.GetVersion(ctx); err == nil {
+		t.Fatal("expected error for missing socket")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("waiting took %v", elapsed)
+	}
+}
@@ -0,0 +1,161 @@
+package privatetransactionmanager
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// PrivacyFlag selects the privacy enhancements the privacy manager applies to
+// a private transaction.
+type PrivacyFlag uint64
+
+const (
+	PrivacyFlagStandardPrivate     PrivacyFlag = 0 // no enhancements
+	PrivacyFlagPartyProtection     PrivacyFlag = 1 // only parties to a contract may interact with it
+	PrivacyFlagStateValidation     PrivacyFlag = 3 // party protection plus private state validation
+	PrivacyFlagMandatoryRecipients PrivacyFlag = 4 // some recipients must be included in every transaction
+)
+
+// SendOptions carries the privacy enhancement settings of a send.
+type SendOptions struct {
+	PrivacyFlag PrivacyFlag
+
+	// MandatoryRecipients are the base64 encoded keys that must receive the
+	// payload. They are required with, and only valid with,
+	// PrivacyFlagMandatoryRecipients and must all be among the recipients.
+	MandatoryRecipients []string
+
+	// AffectedContractTransactions are the hashes of the payloads that
+	// created the contracts the transaction touches, and ExecHash is the
+	// merkle root of the resulting state. Both are required with
+	// PrivacyFlagStateValidation.
+	AffectedContractTransactions []common.EncryptedPayloadHash
+	ExecHash                     string
+
+	// PrivacyGroupID addresses the payload to the members of a privacy group
+	// instead of a list of recipients, which must then be left empty.
+	// Privacy groups are only supported by Tessera.
+	PrivacyGroupID string
+}
+
+// validate checks that the options are consistent with each other and with
+// the recipients b64To.
+func (opts *SendOptions) validate(b64To []string) error {
+	if opts.PrivacyGroupID != "" {
+		if len(b64To) > 0 {
+			return errors.New("recipients and privacy group are mutually exclusive")
+		}
+		if _, err := base64.StdEncoding.DecodeString(opts.PrivacyGroupID); err != nil {
+			return fmt.Errorf("invalid privacy group id %q: %v", opts.PrivacyGroupID, err)
+		}
+	}
+	if opts.PrivacyFlag == PrivacyFlagStateValidation && opts.ExecHash == "" {
+		return errors.New("state validation privacy flag requires an exec hash")
+	}
+	if opts.PrivacyFlag != PrivacyFlagMandatoryRecipients {
+		if len(opts.MandatoryRecipients) > 0 {
+			return errors.New("mandatory recipients require the mandatory recipients privacy flag")
+		}
+		return nil
+	}
+	if len(b64To) == 0 && opts.PrivacyGroupID == "" {
+		return ErrNoRecipients
+	}
+	if len(opts.MandatoryRecipients) == 0 {
+		return errors.New("mandatory recipients privacy flag requires mandatory recipients")
+	}
+	if opts.PrivacyGroupID != "" {
+		// The privacy manager checks them against the group's members.
+		return nil
+	}
+	recipients := make(map[string]bool, len(b64To))
+	for _, to := range b64To {
+		recipients[to] = true
+	}
+	for _, key := range opts.MandatoryRecipients {
+		if !recipients[key] {
+			return fmt.Errorf("mandatory recipient %s is not a recipient", key)
+		}
+	}
+	return nil
+}
+
+// setHeaders adds the options to a send request.
+func (opts *SendOptions) setHeaders(h http.Header) {
+	if opts.PrivacyFlag != PrivacyFlagStandardPrivate {
+		h.Set("c11n-privacy-flag", strconv.FormatUint(uint64(opts.PrivacyFlag), 10))
+	}
+	if len(opts.MandatoryRecipients) > 0 {
+		h.Set("c11n-mandatory-recipients", strings.Join(opts.MandatoryRecipients, ","))
+	}
+	if len(opts.AffectedContractTransactions) > 0 {
+		acoths := make([]string, len(opts.AffectedContractTransactions))
+		for i, hash := range opts.AffectedContractTransactions {
+			acoths[i] = hash.ToBase64()
+		}
+		h.Set("c11n-affected-contract-transactions", strings.Join(acoths, ","))
+	}
+	if opts.ExecHash != "" {
+		h.Set("c11n-exec-hash", opts.ExecHash)
+	}
+	if opts.PrivacyGroupID != "" {
+		h.Set("c11n-privacy-group-id", opts.PrivacyGroupID)
+	}
+}
+
+// ReceiveMeta holds the details a privacy manager reports about a received
+// payload. Fields the privacy manager doesn't report are left empty.
+type ReceiveMeta struct {
+	Sender         PublicKey       // key of the party that sent the payload
+	PrivacyGroupID string          // base64 id of the payload's privacy group
+	PrivacyFlag    PrivacyFlag     // privacy enhancements the payload was sent with
+	Recipient      RecipientStatus // whether the payload was decrypted for the node
+}
+
+// RecipientStatus tells whether the local node is a party to a received
+// payload, and so got it decrypted, or only holds a copy on behalf of others.
+type RecipientStatus int
+
+const (
+	// RecipientUnknown is reported when the privacy manager doesn't say, as
+	// with Constellation and the raw API. Both only decrypt payloads for
+	// nodes holding a recipient key, and answer others with
+	// ErrPayloadNotFound or an empty payload, so a non-empty payload received
+	// this way is plaintext.
+	RecipientUnknown RecipientStatus = iota
+
+	// RecipientLocal means keys managed by the node are parties to the
+	// payload, which was decrypted for them.
+	RecipientLocal
+
+	// RecipientRelay means none of the node's keys is a party to the
+	// payload: the node only relays it, and the payload returned must not be
+	// treated as plaintext.
+	RecipientRelay
+)
+
+// parseReceiveMeta reads the payload details from a receive response.
+func parseReceiveMeta(h http.Header) (*ReceiveMeta, error) {
+	meta := &ReceiveMeta{PrivacyGroupID: h.Get("c11n-privacy-group-id")}
+	if sender := h.Get("c11n-from"); sender != "" {
+		key, err := ParsePublicKey(sender)
+		if err != nil {
+			return nil, fmt.Errorf("sender of received payload: %v", err)
+		}
+		meta.Sender = key
+	}
+	if flag := h.Get("c11n-privacy-flag"); flag != "" {
+		n, err := strconv.ParseUint(flag, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid privacy flag %q in receive response", flag)
+		}
+		meta.PrivacyFlag = PrivacyFlag(n)
+	}
+	return meta, nil
+}
@@ -0,0 +1,130 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestSendOptionsValidate(t *testing.T) {
+	to := []string{"a", "b"}
+	tests := []struct {
+		opts SendOptions
+		ok   bool
+	}{
+		{SendOptions{}, true},
+		{SendOptions{PrivacyFlag: PrivacyFlagStateValidation, ExecHash: "root"}, true},
+		{SendOptions{PrivacyFlag: PrivacyFlagStateValidation}, false},
+		{SendOptions{PrivacyFlag: PrivacyFlagMandatoryRecipients, MandatoryRecipients: []string{"b"}}, true},
+		{SendOptions{PrivacyFlag: PrivacyFlagMandatoryRecipients}, false},
+		{SendOptions{PrivacyFlag: PrivacyFlagMandatoryRecipients, MandatoryRecipients: []string{"c"}}, false},
+		{SendOptions{PrivacyFlag: PrivacyFlagPartyProtection, MandatoryRecipients: []string{"a"}}, false},
+	}
+	for i, test := range tests {
+		if err := test.opts.validate(to); (err == nil) != test.ok {
+			t.Errorf("test %d: got error %v, want ok %t", i, err, test.ok)
+		}
+	}
+}
+
+func TestSendPayloadMandatoryRecipients(t *testing.T) {
+	var flag, mandatory string
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flag = r.Header.Get("c11n-privacy-flag")
+		mandatory = r.Header.Get("c11n-mandatory-recipients")
+		w.Write([]byte(testPayloadHash.ToBase64()))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b, cc := testKey(1), testKey(2), testKey(3)
+	opts := &SendOptions{PrivacyFlag: PrivacyFlagMandatoryRecipients, MandatoryRecipients: []string{a, cc}}
+	if _, err := c.SendPayloadWithOptions(context.Background(), []byte("payload"), "", []string{a, b, cc}, opts); err != nil {
+		t.Fatal(err)
+	}
+	if want := a + "," + cc; flag != "4" || mandatory != want {
+		t.Fatalf("got flag %q and mandatory recipients %q, want %q and %q", flag, mandatory, "4", want)
+	}
+}
+
+func TestSendPayloadStateValidation(t *testing.T) {
+	var acoths, execHash string
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acoths = r.Header.Get("c11n-affected-contract-transactions")
+		execHash = r.Header.Get("c11n-exec-hash")
+		w.Write([]byte(testPayloadHash.ToBase64()))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := common.BytesToEncryptedPayloadHash([]byte("a")), common.BytesToEncryptedPayloadHash([]byte("b"))
+	opts := &SendOptions{
+		PrivacyFlag:                  PrivacyFlagStateValidation,
+		AffectedContractTransactions: []common.EncryptedPayloadHash{a, b},
+		ExecHash:                     "root",
+	}
+	if _, err := c.SendPayloadWithOptions(context.Background(), []byte("payload"), "", []string{testRecipient}, opts); err != nil {
+		t.Fatal(err)
+	}
+	if want := a.ToBase64() + "," + b.ToBase64(); acoths != want {
+		t.Fatalf("got affected contract transactions %q, want %q", acoths, want)
+	}
+	if execHash != "root" {
+		t.Fatalf("got exec hash %q, want %q", execHash, "root")
+	}
+}
+
+func TestSendPayloadPrivacyGroup(t *testing.T) {
+	group := testKey(5)
+	var gotGroup, gotTo string
+	var gotJSON sendReq
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/send" {
+			json.NewDecoder(r.Body).Decode(&gotJSON)
+			json.NewEncoder(w).Encode(&sendResp{Key: testPayloadHash.ToBase64()})
+			return
+		}
+		gotGroup, gotTo = r.Header.Get("c11n-privacy-group-id"), r.Header.Get("c11n-to")
+		w.Write([]byte(testPayloadHash.ToBase64()))
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &SendOptions{PrivacyGroupID: group}
+	if _, err := c.SendPayloadWithOptions(context.Background(), []byte("payload"), "", nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	if gotGroup != group || gotTo != "" {
+		t.Fatalf("got privacy group %q and recipients %q, want %q and none", gotGroup, gotTo, group)
+	}
+	if _, err := c.SendPayloadWithOptions(context.Background(), []byte("payload"), "", []string{testRecipient}, opts); err == nil {
+		t.Fatal("expected error for recipients and privacy group")
+	}
+	bad := &SendOptions{PrivacyGroupID: "not base64!"}
+	if _, err := c.SendPayloadWithOptions(context.Background(), []byte("payload"), "", nil, bad); err == nil {
+		t.Fatal("expected error for invalid privacy group id")
+	}
+
+	c, err = NewClient(socketPath, WithAPI(JSONAPI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SendPayloadWithOptions(context.Background(), []byte("payload"), "", nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	if gotJSON.PrivacyGroupID != group || len(gotJSON.To) != 0 {
+		t.Fatalf("got JSON request %+v, want privacy group %q", gotJSON, group)
+	}
+}
@@ -0,0 +1,203 @@
+package privatetransactionmanager
+
+import (
+	"errors"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRestartDelay    = 1 * time.Second
+	defaultMaxRestartDelay = 30 * time.Second
+)
+
+// SupervisorConfig controls how a Supervisor restarts its node.
+type SupervisorConfig struct {
+	// MaxRestarts is the number of times the node is restarted after
+	// exiting unexpectedly before the supervisor gives up. Negative values
+	// mean the node is restarted indefinitely.
+	MaxRestarts int
+
+	// RestartDelay is the delay before the first restart, doubling with
+	// every further attempt up to MaxRestartDelay. They default to 1s and
+	// 30s respectively.
+	RestartDelay    time.Duration
+	MaxRestartDelay time.Duration
+
+	// ResetAfter is how long a node must stay up for its run to count as
+	// healthy: when it exits after that, restarts are counted and backed off
+	// from scratch, so that a long-lived node crashing now and then isn't
+	// given up on eventually. It defaults to MaxRestartDelay.
+	ResetAfter time.Duration
+}
+
+// NodeExit reports that a supervised node exited or failed to restart.
+type NodeExit struct {
+	Err        error // the exit status, nil on a clean exit, or the error of a failed restart
+	Restarts   int   // number of restarts attempted so far
+	Restarting bool  // whether the supervisor will restart the node
+}
+
+// Supervisor runs a privacy manager node launched with LaunchNode and restarts
+// it with exponential backoff if it exits unexpectedly. A node exiting with
+// status 0, e.g. one shut down on purpose, is not restarted.
+type Supervisor struct {
+	binaryPath, cfgPath string
+	launchOpts          []LaunchOption
+	config              SupervisorConfig
+	exits               chan NodeExit
+
+	mu          sync.Mutex
+	cmd         *exec.Cmd
+	quit        chan struct{}
+	done        chan struct{}
+	stopTimeout time.Duration
+	stopErr     error
+}
+
+// NewSupervisor creates a supervisor for the node LaunchNode starts from
+// binaryPath, cfgPath and opts. The node is started by Start.
+func NewSupervisor(binaryPath, cfgPath string, config SupervisorConfig, opts ...LaunchOption) *Supervisor {
+	if config.RestartDelay <= 0 {
+		config.RestartDelay = defaultRestartDelay
+	}
+	if config.MaxRestartDelay <= 0 {
+		config.MaxRestartDelay = defaultMaxRestartDelay
+	}
+	if config.ResetAfter <= 0 {
+		config.ResetAfter = config.MaxRestartDelay
+	}
+	return &Supervisor{
+		binaryPath: binaryPath,
+		cfgPath:    cfgPath,
+		launchOpts: opts,
+		config:     config,
+		exits:      make(chan NodeExit, 16),
+	}
+}
+
+// Start launches the node and begins supervising it.
+func (s *Supervisor) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.quit != nil {
+		return errors.New("privacy manager supervisor already started")
+	}
+	cmd, err := LaunchNode(s.binaryPath, s.cfgPath, s.launchOpts...)
+	if err != nil {
+		return err
+	}
+	s.cmd = cmd
+	s.quit, s.done = make(chan struct{}), make(chan struct{})
+	go s.run(cmd)
+	return nil
+}
+
+// Exits returns the channel on which exits of the node are reported,
+// including a clean exit, which ends supervision. Events are dropped if the
+// channel is not drained.
+func (s *Supervisor) Exits() <-chan NodeExit {
+	return s.exits
+}
+
+// PID returns the process ID of the running node. It reports false if the
+// supervisor has not been started or the node is down, e.g. while waiting
+// to restart it.
+func (s *Supervisor) PID() (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return NodePID(s.cmd)
+}
+
+// Stop ends supervision and shuts down the node like StopNode.
+func (s *Supervisor) Stop(timeout time.Duration) error {
+	s.mu.Lock()
+	if s.quit == nil {
+		s.mu.Unlock()
+		return errors.New("privacy manager supervisor not started")
+	}
+	select {
+	case <-s.quit:
+	default:
+		s.stopTimeout = timeout
+		close(s.quit)
+	}
+	s.mu.Unlock()
+
+	<-s.done
+	return s.stopErr
+}
+
+func (s *Supervisor) run(cmd *exec.Cmd) {
+	defer close(s.done)
+
+	restarts := 0
+	for {
+		started := time.Now()
+		exited := waitNode(cmd)
+
+		select {
+		case <-s.quit:
+			s.stopErr = stopProcess(cmd, exited, s.stopTimeout)
+			return
+		case err := <-exited:
+			s.mu.Lock()
+			s.cmd = nil
+			s.mu.Unlock()
+			if err == nil {
+				s.notify(NodeExit{Restarts: restarts})
+				return
+			}
+			if time.Since(started) >= s.config.ResetAfter {
+				restarts = 0
+			}
+			s.notify(NodeExit{Err: err, Restarts: restarts, Restarting: s.canRestart(restarts)})
+		}
+		// Keep trying to bring the node back until restarts are exhausted.
+		for {
+			if !s.canRestart(restarts) {
+				return
+			}
+			restarts++
+			select {
+			case <-s.quit:
+				return
+			case <-time.After(s.restartDelay(restarts)):
+			}
+			next, err := LaunchNode(s.binaryPath, s.cfgPath, s.launchOpts...)
+			if err == nil {
+				s.mu.Lock()
+				s.cmd = next
+				s.mu.Unlock()
+				cmd = next
+				break
+			}
+			s.notify(NodeExit{Err: err, Restarts: restarts, Restarting: s.canRestart(restarts)})
+		}
+	}
+}
+
+func (s *Supervisor) canRestart(restarts int) bool {
+	return s.config.MaxRestarts < 0 || restarts < s.config.MaxRestarts
+}
+
+// restartDelay returns the backoff before the given restart attempt.
+func (s *Supervisor) restartDelay(attempt int) time.Duration {
+	delay := s.config.RestartDelay
+	for i := 1; i < attempt && delay < s.config.MaxRestartDelay; i++ {
+		delay *= 2
+	}
+	if delay > s.config.MaxRestartDelay {
+		delay = s.config.MaxRestartDelay
+	}
+	return delay
+}
+
+func (s *Supervisor) notify(exit NodeExit) {
+	select {
+	case s.exits <- exit:
+	default:
+	}
+}
@@ -0,0 +1,123 @@
+package privatetransactionmanager
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSupervisorRestartsCrashedNode(t *testing.T) {
+	cfgPath, cleanup := testNodeConfig(t, 200*time.Millisecond)
+	defer cleanup()
+
+	s := NewSupervisor(os.Args[0], cfgPath, SupervisorConfig{MaxRestarts: 2, RestartDelay: 10 * time.Millisecond})
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop(time.Second)
+
+	for i := 0; i <= 2; i++ {
+		select {
+		case exit := <-s.Exits():
+			if exit.Err == nil || exit.Restarts != i || exit.Restarting != (i < 2) {
+				t.Fatalf("exit %d: got %+v", i, exit)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("exit %d not reported", i)
+		}
+	}
+}
+
+func TestSupervisorResetsRestarts(t *testing.T) {
+	cfgPath, cleanup := testNodeConfig(t, 200*time.Millisecond)
+	defer cleanup()
+
+	// Every run lasts longer than ResetAfter, so the node is restarted past
+	// MaxRestarts.
+	config := SupervisorConfig{MaxRestarts: 1, RestartDelay: 10 * time.Millisecond, ResetAfter: 50 * time.Millisecond}
+	s := NewSupervisor(os.Args[0], cfgPath, config)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop(time.Second)
+
+	for i := 0; i < 3; i++ {
+		select {
+		case exit := <-s.Exits():
+			if exit.Err == nil || exit.Restarts != 0 || !exit.Restarting {
+				t.Fatalf("exit %d: got %+v", i, exit)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("exit %d not reported", i)
+		}
+	}
+}
+
+func TestSupervisorCleanExit(t *testing.T) {
+	cfgPath, cleanup := testNodeConfig(t, 200*time.Millisecond)
+	defer cleanup()
+	os.Setenv("PTM_TEST_NODE_EXIT_STATUS", "0")
+	defer os.Unsetenv("PTM_TEST_NODE_EXIT_STATUS")
+
+	s := NewSupervisor(os.Args[0], cfgPath, SupervisorConfig{MaxRestarts: -1, RestartDelay: 10 * time.Millisecond})
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop(time.Second)
+
+	select {
+	case exit := <-s.Exits():
+		if exit.Err != nil || exit.Restarting {
+			t.Fatalf("got %+v, want a clean exit without restart", exit)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("exit not reported")
+	}
+	select {
+	case exit := <-s.Exits():
+		t.Fatalf("node was restarted after a clean exit, then reported %+v", exit)
+	case <-time.After(500 * time.Millisecond):
+	}
+	if _, ok := s.PID(); ok {
+		t.Fatal("node running after a clean exit")
+	}
+}
+
+func TestSupervisorStop(t *testing.T) {
+	cfgPath, cleanup := testNodeConfig(t, 0)
+	defer cleanup()
+
+	s := NewSupervisor(os.Args[0], cfgPath, SupervisorConfig{MaxRestarts: -1})
+	if _, ok := s.PID(); ok {
+		t.Fatal("got pid before supervisor was started")
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err == nil {
+		t.Fatal("expected error starting supervisor twice")
+	}
+	if pid, ok := s.PID(); !ok || pid <= 0 {
+		t.Fatalf("got pid %d, %v for running node", pid, ok)
+	}
+	if err := s.Stop(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case exit := <-s.Exits():
+		t.Fatalf("stopping the node reported exit %+v", exit)
+	default:
+	}
+}
+
+func TestSupervisorRestartDelay(t *testing.T) {
+	s := NewSupervisor("", "", SupervisorConfig{RestartDelay: time.Second, MaxRestartDelay: 5 * time.Second})
+	for attempt, want := range []time.Duration{0, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if attempt == 0 {
+			continue
+		}
+		if delay := s.restartDelay(attempt); delay != want {
+			t.Errorf("attempt %d: got delay %v, want %v", attempt, delay, want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package privatetransactionmanager
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// NewTLSConfig builds a TLS configuration for connecting to a remote privacy
+// manager. certFile and keyFile hold the client certificate presented for
+// mutual TLS, caFile a PEM bundle used instead of the system roots to verify
+// the server, and serverName overrides the name sent for SNI and checked
+// against the server certificate. Empty arguments leave the corresponding
+// setting at its default.
+func NewTLSConfig(certFile, keyFile, caFile, serverName string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName: serverName,
+	}
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, errors.New("both a client certificate and key are required for mutual TLS")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// NewReloadingTLSConfig is like NewTLSConfig, for a client certificate that is
+// rotated by replacing certFile and keyFile: the files are checked for changes
+// whenever a connection is made, and a changed pair is loaded for it and the
+// following connections. If the new pair can't be loaded, e.g. because only
+// one of the files has been replaced so far, the previous certificate keeps
+// being presented until it can. Connections made before a rotation, including
+// idle ones kept for reuse, keep the certificate they were made with until
+// they are closed; WithIdleConnTimeout bounds how long an idle one is kept.
+// Only the client certificate is reloaded, the CA bundle is read once.
+func NewReloadingTLSConfig(certFile, keyFile, caFile, serverName string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("both a client certificate and key are required for mutual TLS")
+	}
+	cfg, err := NewTLSConfig("", "", caFile, serverName)
+	if err != nil {
+		return nil, err
+	}
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	modTime, err := r.modTime()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+	cfg.GetClientCertificate = r.clientCertificate
+	return cfg, nil
+}
+
+// certReloader loads a client certificate anew whenever its files change.
+type certReloader struct {
+	certFile, keyFile string
+
+	mu     sync.Mutex
+	cert   *tls.Certificate
+	loaded time.Time // modification time of the files cert was loaded from
+}
+
+// clientCertificate is the tls.Config.GetClientCertificate callback.
+func (r *certReloader) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if modTime, err := r.modTime(); err == nil && !modTime.Equal(r.loaded) {
+		// On failure the previous certificate is kept and loading is tried
+		// again on the next connection.
+		r.load(modTime)
+	}
+	return r.cert, nil
+}
+
+// load reads the certificate and key, last modified at modTime.
+func (r *certReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert, r.loaded = &cert, modTime
+	return nil
+}
+
+// modTime returns the latest modification time of the certificate and key.
+func (r *certReloader) modTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
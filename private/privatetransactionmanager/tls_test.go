@@ -0,0 +1,237 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTLSConfigCustomCA(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("payload"))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "ptm-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The test server certificate is issued for example.com, so verification
+	// only succeeds with the SNI override in place.
+	tlsConfig, err := NewTLSConfig("", "", caFile, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewClientFromURL(srv.URL, WithTLSConfig(tlsConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ReceivePayload(context.Background(), []byte("key")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the custom CA the server certificate is not trusted.
+	c, err = NewClientFromURL(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ReceivePayload(context.Background(), []byte("key")); err == nil {
+		t.Fatal("expected certificate verification failure")
+	}
+}
+
+func TestNewTLSConfigRequiresKeyPair(t *testing.T) {
+	if _, err := NewTLSConfig("client.pem", "", "", ""); err == nil {
+		t.Fatal("expected error for certificate without key")
+	}
+}
+
+// writeClientCert writes a self-signed client certificate for commonName and its
+// key to certFile and keyFile, with modTime as their modification time.
+func writeClientCert(t *testing.T, certFile, keyFile, commonName string, modTime time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{certFile, keyFile} {
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReloadingTLSConfig(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Close every connection, so that each request presents a certificate.
+		w.Header().Set("Connection", "close")
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "ptm-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	start := time.Now().Add(-time.Minute)
+	writeClientCert(t, certFile, keyFile, "first", start)
+
+	tlsConfig, err := NewReloadingTLSConfig(certFile, keyFile, "", "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig.RootCAs = x509.NewCertPool()
+	tlsConfig.RootCAs.AddCert(srv.Certificate())
+	c, err := NewClientFromURL(srv.URL, WithTLSConfig(tlsConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	presented := func(want string) {
+		t.Helper()
+		name, err := c.ReceivePayload(context.Background(), []byte("key"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(name) != want {
+			t.Fatalf("client presented certificate %q, want %q", name, want)
+		}
+	}
+	presented("first")
+
+	writeClientCert(t, certFile, keyFile, "second", start.Add(time.Second))
+	presented("second")
+
+	// A half-finished rotation keeps the current certificate in use.
+	if err := ioutil.WriteFile(keyFile, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	presented("second")
+
+	if _, err := NewReloadingTLSConfig(filepath.Join(dir, "missing.pem"), keyFile, "", ""); err == nil {
+		t.Fatal("expected error for missing certificate")
+	}
+}
+
+func TestHTTP2(t *testing.T) {
+	var conns connCounter
+	var http1 int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 1 {
+			atomic.AddInt32(&http1, 1)
+		}
+		w.Write([]byte("payload"))
+	}))
+	srv.Config.ConnState = conns.track
+	srv.TLS = &tls.Config{NextProtos: []string{"h2", "http/1.1"}}
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	tlsConfig := &tls.Config{RootCAs: roots, ServerName: "example.com"}
+
+	receive := func(c *Client) {
+		t.Helper()
+		if _, err := c.ReceivePayload(context.Background(), []byte("key")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, err := NewClientFromURL(srv.URL, WithTLSConfig(tlsConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive(c)
+	if n := atomic.LoadInt32(&http1); n != 1 {
+		t.Fatalf("got %d HTTP/1 requests without WithHTTP2, want 1", n)
+	}
+	c.Close()
+
+	atomic.StoreInt32(&http1, 0)
+	c, err = NewClientFromURL(srv.URL, WithTLSConfig(tlsConfig), WithHTTP2())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	receive(c)
+	before := conns.count()
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.ReceivePayload(context.Background(), []byte("key"))
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := atomic.LoadInt32(&http1); n != 0 {
+		t.Fatalf("got %d HTTP/1 requests with WithHTTP2", n)
+	}
+	if n := conns.count(); n != before {
+		t.Fatalf("20 concurrent receives opened %d connections, want none", n-before)
+	}
+
+	// The option is harmless for unix socket clients.
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("payload"))
+	}))
+	defer shutdown()
+	if c, err = NewClient(socketPath, WithHTTP2()); err != nil {
+		t.Fatal(err)
+	}
+	receive(c)
+}
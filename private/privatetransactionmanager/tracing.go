@@ -0,0 +1,53 @@
+package privatetransactionmanager
+
+import (
+	"net/http"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	otlog "github.com/opentracing/opentracing-go/log"
+)
+
+// startSpan starts a span for a request as a child of any span carried by the
+// request context, and returns the request with the new span attached. The
+// span is nil if the client has no tracer.
+func (c *Client) startSpan(op operation, req *http.Request) (opentracing.Span, *http.Request) {
+	tracer := c.cfg.tracer
+	if tracer == nil {
+		return nil, req
+	}
+	var opts []opentracing.StartSpanOption
+	if parent := opentracing.SpanFromContext(req.Context()); parent != nil {
+		opts = append(opts, opentracing.ChildOf(parent.Context()))
+	}
+	span := tracer.StartSpan("ptm."+op.name, opts...)
+	ext.SpanKindRPCClient.Set(span)
+	ext.HTTPMethod.Set(span, req.Method)
+	if req.ContentLength > 0 {
+		span.SetTag("payload.size", req.ContentLength)
+	}
+	if to := headerRecipients(req.Header); len(to) > 0 {
+		span.SetTag("recipients", len(to))
+	}
+	// Let a traced privacy manager continue the trace; failing to inject is
+	// not worth failing the request over.
+	tracer.Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(req.Header))
+
+	return span, req.WithContext(opentracing.ContextWithSpan(req.Context(), span))
+}
+
+// finishSpan records the outcome of a request on its span and finishes it.
+// code is the response status code, or zero if no response was received.
+func finishSpan(span opentracing.Span, code int, err error) {
+	if span == nil {
+		return
+	}
+	if code != 0 {
+		ext.HTTPStatusCode.Set(span, uint16(code))
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.LogFields(otlog.Error(err))
+	}
+	span.Finish()
+}
@@ -0,0 +1,174 @@
+package privatetransactionmanager
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	otlog "github.com/opentracing/opentracing-go/log"
+)
+
+// recordingTracer records the spans it starts. It stands in for opentracing's
+// mocktracer, which isn't vendored.
+type recordingTracer struct {
+	opentracing.NoopTracer
+
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) StartSpan(name string, opts ...opentracing.StartSpanOption) opentracing.Span {
+	var sso opentracing.StartSpanOptions
+	for _, opt := range opts {
+		opt.Apply(&sso)
+	}
+	span := &recordedSpan{
+		Span: t.NoopTracer.StartSpan(name),
+		name: name,
+		tags: make(map[string]interface{}),
+	}
+	for _, ref := range sso.References {
+		if parent, ok := ref.ReferencedContext.(recordedContext); ok && ref.Type == opentracing.ChildOfRef {
+			span.parent = parent.span
+		}
+	}
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+	return span
+}
+
+// finished returns the finished spans named name.
+func (t *recordingTracer) finished(name string) []*recordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var spans []*recordedSpan
+	for _, span := range t.spans {
+		if span.name == name && span.isFinished() {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+// recordedSpan is a span of a recordingTracer. Methods it doesn't record go
+// to a no-op span.
+type recordedSpan struct {
+	opentracing.Span
+	name   string
+	parent *recordedSpan
+
+	mu       sync.Mutex
+	tags     map[string]interface{}
+	logs     []otlog.Field
+	finished bool
+}
+
+type recordedContext struct {
+	span *recordedSpan
+}
+
+func (recordedContext) ForeachBaggageItem(func(k, v string) bool) {}
+
+func (s *recordedSpan) Context() opentracing.SpanContext {
+	return recordedContext{s}
+}
+
+func (s *recordedSpan) SetTag(key string, value interface{}) opentracing.Span {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tags[key] = value
+	return s
+}
+
+func (s *recordedSpan) LogFields(fields ...otlog.Field) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logs = append(s.logs, fields...)
+}
+
+func (s *recordedSpan) Finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finished = true
+}
+
+func (s *recordedSpan) isFinished() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.finished
+}
+
+func (s *recordedSpan) tag(key string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tags[key]
+}
+
+// loggedError returns the value of the error field logged on the span.
+func (s *recordedSpan) loggedError() interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, field := range s.logs {
+		if field.Key() == "error" {
+			return field.Value()
+		}
+	}
+	return nil
+}
+
+func TestTracing(t *testing.T) {
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/version" {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("I'm up!"))
+	}))
+	defer shutdown()
+
+	tracer := new(recordingTracer)
+	c, err := NewClient(socketPath, WithTracer(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := tracer.StartSpan("caller").(*recordedSpan)
+	ctx := opentracing.ContextWithSpan(context.Background(), parent)
+	if _, err := c.HealthCheck(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetVersion(ctx); err == nil {
+		t.Fatal("expected version request to fail")
+	}
+
+	tests := []struct {
+		name string
+		code uint16
+		err  bool
+	}{
+		{"ptm.upcheck", http.StatusOK, false},
+		{"ptm.version", http.StatusInternalServerError, true},
+	}
+	for _, test := range tests {
+		spans := tracer.finished(test.name)
+		if len(spans) != 1 {
+			t.Fatalf("got %d finished %s spans, want 1", len(spans), test.name)
+		}
+		span := spans[0]
+		if span.parent != parent {
+			t.Errorf("%s: span is not a child of the caller's span", test.name)
+		}
+		if code := span.tag("http.status_code"); code != test.code {
+			t.Errorf("%s: got status code tag %v, want %d", test.name, code, test.code)
+		}
+		if failed := span.tag("error") == true; failed != test.err {
+			t.Errorf("%s: got error tag %v, want %t", test.name, span.tag("error"), test.err)
+		}
+		if logged := span.loggedError() != nil; logged != test.err {
+			t.Errorf("%s: got logged error %v, want one: %t", test.name, span.loggedError(), test.err)
+		}
+	}
+}
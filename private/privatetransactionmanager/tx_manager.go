@@ -1,9 +1,10 @@
 package privatetransactionmanager
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/private/cache"
@@ -11,24 +12,22 @@ import (
 )
 
 type PrivateTransactionManager struct {
-	node *Client
+	node Node
 	c    *gocache.Cache
 }
 
-func (g *PrivateTransactionManager) Send(data []byte, from string, to []string) (out common.EncryptedPayloadHash, err error) {
-	var b []byte
-	b, err = g.node.SendPayload(data, from, to)
+func (g *PrivateTransactionManager) Send(data []byte, from string, to []string) (common.EncryptedPayloadHash, error) {
+	out, err := g.node.SendPayload(context.Background(), data, from, to)
 	if err != nil {
 		return common.EncryptedPayloadHash{}, err
 	}
-	g.c.Set(string(b), data, cache.DefaultExpiration)
-	out = common.BytesToEncryptedPayloadHash(b)
-	return
+	g.c.Set(string(out.Bytes()), data, cache.DefaultExpiration)
+	return out, nil
 }
 
 func (g *PrivateTransactionManager) StoreRaw(data []byte, from string) (out common.EncryptedPayloadHash, err error) {
 	var b []byte
-	b, err = g.node.StorePayload(data, from)
+	b, err = g.node.StorePayload(context.Background(), data, from)
 	if err != nil {
 		return common.EncryptedPayloadHash{}, err
 	}
@@ -38,7 +37,7 @@ func (g *PrivateTransactionManager) StoreRaw(data []byte, from string) (out comm
 }
 
 func (g *PrivateTransactionManager) SendSignedTx(txHash common.EncryptedPayloadHash, to []string) (out []byte, err error) {
-	out, err = g.node.SendSignedPayload(txHash.Bytes(), to)
+	out, err = g.node.SendSignedPayload(context.Background(), txHash.Bytes(), to)
 	if err != nil {
 		return nil, err
 	}
@@ -49,56 +48,78 @@ func (g *PrivateTransactionManager) Receive(txHash common.EncryptedPayloadHash)
 	if common.EmptyEncryptedPayloadHash(txHash) {
 		return []byte{}, nil
 	}
-	// Ignore this error since not being a recipient of
-	// a payload isn't an error.
-	// TODO: Return an error if it's anything OTHER than
-	// 'you are not a recipient.'
 	dataStr := string(txHash.Bytes())
 	x, found := g.c.Get(dataStr)
 	if found {
 		return x.([]byte), nil
 	}
-	pl, _ := g.node.ReceivePayload(txHash.Bytes())
+	pl, err := g.node.ReceivePayload(context.Background(), txHash.Bytes())
+	if errors.Is(err, ErrPayloadNotFound) {
+		// Not being a recipient of a payload isn't an error.
+		pl, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
 	g.c.Set(dataStr, pl, cache.DefaultExpiration)
 	return pl, nil
 }
 
 func (g *PrivateTransactionManager) IsSender(txHash common.EncryptedPayloadHash) (bool, error) {
-	return g.node.IsSender(txHash)
+	return g.node.IsSender(context.Background(), txHash)
 }
 
 func (g *PrivateTransactionManager) GetParticipants(txHash common.EncryptedPayloadHash) ([]string, error) {
-
-	return g.node.GetParticipants(txHash)
-}
-
-func New(path string) (*PrivateTransactionManager, error) {
-	info, err := os.Lstat(path)
+	keys, err := g.node.GetParticipants(context.Background(), txHash)
 	if err != nil {
 		return nil, err
 	}
+	participants := make([]string, len(keys))
+	for i, key := range keys {
+		participants[i] = key.String()
+	}
+	return participants, nil
+}
+
+func New(path string) (*PrivateTransactionManager, error) {
 	// We accept either the socket or a configuration file that points to
 	// a socket.
-	isSocket := info.Mode()&os.ModeSocket != 0
+	isSocket := isAbstractSocket(path)
+	if !isSocket {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return nil, err
+		}
+		isSocket = info.Mode()&os.ModeSocket != 0
+	}
 	if !isSocket {
 		cfg, err := LoadConfig(path)
 		if err != nil {
 			return nil, err
 		}
-		path = filepath.Join(cfg.WorkDir, cfg.Socket)
+		path = cfg.SocketFile()
 	}
-	err = RunNode(path)
-	if err != nil {
+	if err := RunNode(path); err != nil {
 		return nil, err
 	}
 	n, err := NewClient(path)
 	if err != nil {
 		return nil, err
 	}
+	// Validate warns about a socket open to all users.
+	if err := n.Validate(); err != nil {
+		return nil, err
+	}
+	return NewWithNode(n), nil
+}
+
+// NewWithNode creates a PrivateTransactionManager talking to the given privacy
+// manager, e.g. a fake in tests.
+func NewWithNode(node Node) *PrivateTransactionManager {
 	return &PrivateTransactionManager{
-		node: n,
+		node: node,
 		c:    cache.NewDefaultCache(),
-	}, nil
+	}
 }
 
 func MustNew(path string) *PrivateTransactionManager {
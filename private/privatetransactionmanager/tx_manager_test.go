@@ -0,0 +1,50 @@
+package privatetransactionmanager
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestPrivateTransactionManagerReceive(t *testing.T) {
+	known := common.BytesToEncryptedPayloadHash([]byte("known"))
+	var failing int32 = 1
+	socketPath, shutdown := newTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Header.Get("c11n-key") != known.ToBase64():
+			http.NotFound(w, r)
+		case atomic.LoadInt32(&failing) != 0:
+			http.Error(w, "database unavailable", http.StatusInternalServerError)
+		default:
+			w.Write([]byte("payload"))
+		}
+	}))
+	defer shutdown()
+
+	c, err := NewClient(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ptm := NewWithNode(c)
+
+	// Not being a recipient isn't an error.
+	pl, err := ptm.Receive(common.BytesToEncryptedPayloadHash([]byte("unknown")))
+	if err != nil || pl != nil {
+		t.Fatalf("got payload %q, error %v for unknown payload, want none", pl, err)
+	}
+
+	// Other failures are reported, and not cached.
+	if _, err := ptm.Receive(known); err == nil {
+		t.Fatal("expected error from failing privacy manager")
+	}
+	atomic.StoreInt32(&failing, 0)
+	pl, err = ptm.Receive(known)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(pl) != "payload" {
+		t.Fatalf("got payload %q, want %q", pl, "payload")
+	}
+}